@@ -0,0 +1,137 @@
+package autoplay
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// How long the bot holds a key down for a tap or lift
+const tapLength = 40 * time.Millisecond
+
+// Bot plays a chart by generating the inputs that a player would make
+type Bot struct {
+	// Hits are offset from their notes by a normal distribution with this
+	// mean and standard deviation, so that a zero Bot is perfect
+	Mean  time.Duration
+	Stdev time.Duration
+
+	// Whether keys are released, otherwise only presses are made, so
+	// holds are never let go of and lifts are always missed
+	Releases bool
+
+	// The gap between taps of a roll
+	RollInterval time.Duration
+
+	Rand *rand.Rand
+}
+
+// NewBot is a perfect Bot that releases keys
+func NewBot() *Bot {
+	return &Bot{
+		Releases:     true,
+		RollInterval: 100 * time.Millisecond,
+		Rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// offset is how far from a note the bot hits it
+func (b *Bot) offset() time.Duration {
+	if b.Stdev == 0 || nil == b.Rand {
+		return b.Mean
+	}
+	return b.Mean + time.Duration(b.Rand.NormFloat64()*float64(b.Stdev))
+}
+
+// Inputs are the inputs that play chart at rate, in time order
+func (b *Bot) Inputs(chart *game.Chart, rate uint16) []game.Input {
+	real := func(d time.Duration) time.Duration {
+		return time.Duration(d * 100 / time.Duration(rate))
+	}
+
+	inputs := []game.Input{}
+	press := func(index uint8, t time.Duration) {
+		inputs = append(inputs, game.Input{Index: index, HitTime: t})
+	}
+	release := func(index uint8, t time.Duration) {
+		if b.Releases {
+			inputs = append(inputs, game.Input{Index: index, HitTime: t, Release: true})
+		}
+	}
+
+	// The time of the next note in the same column as each note, so that
+	// taps are released before it
+	next := make([]time.Duration, len(chart.Notes))
+	following := map[uint8]time.Duration{}
+	for i := len(chart.Notes) - 1; i >= 0; i-- {
+		note := chart.Notes[i]
+		if t, ok := following[note.Index]; ok {
+			next[i] = t
+		} else {
+			next[i] = real(note.Time) + time.Hour
+		}
+		if note.IsJudged() {
+			following[note.Index] = real(note.Time)
+		}
+	}
+
+	// The end of the last key press in each column, which the next press
+	// must come after
+	free := map[uint8]time.Duration{}
+	for i, note := range chart.Notes {
+		if !note.IsJudged() {
+			continue
+		}
+		length := tapLength
+		if gap := (next[i] - real(note.Time)) / 2; gap < length {
+			length = gap
+		}
+		t := real(note.Time) + b.offset()
+		if t <= free[note.Index] {
+			t = free[note.Index] + time.Millisecond
+		}
+
+		switch note.Kind {
+		case game.KindHold:
+			end := real(note.TimeEnd) + b.offset()
+			if end <= t {
+				end = t + time.Millisecond
+			}
+			press(note.Index, t)
+			release(note.Index, end)
+			free[note.Index] = end
+		case game.KindRoll:
+			end := real(note.TimeEnd)
+			interval := b.RollInterval
+			if interval <= 0 {
+				interval = 100 * time.Millisecond
+			}
+			for tap := t; tap < end; tap += interval {
+				press(note.Index, tap)
+				release(note.Index, tap+interval/2)
+			}
+			free[note.Index] = end
+		case game.KindLift:
+			// Press the key just before, so that there is something to lift
+			down := t - length
+			if down <= free[note.Index] {
+				down = free[note.Index] + time.Millisecond
+			}
+			if down >= t {
+				t = down + time.Millisecond
+			}
+			press(note.Index, down)
+			release(note.Index, t)
+			free[note.Index] = t
+		default:
+			press(note.Index, t)
+			release(note.Index, t+length)
+			free[note.Index] = t + length
+		}
+	}
+
+	sort.SliceStable(inputs, func(i, j int) bool { return inputs[i].HitTime < inputs[j].HitTime })
+	return inputs
+}
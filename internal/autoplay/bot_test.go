@@ -0,0 +1,97 @@
+package autoplay
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/score"
+)
+
+func botChart() *game.Chart {
+	return &game.Chart{
+		Notes: []*game.Note{
+			{Index: 0, Time: time.Second},
+			{Index: 1, Kind: game.KindHold, Time: time.Second, TimeEnd: 2 * time.Second},
+			{Index: 0, Time: 1100 * time.Millisecond},
+			{Index: 2, Kind: game.KindRoll, Time: 1500 * time.Millisecond, TimeEnd: 2500 * time.Millisecond},
+			{Index: 3, Kind: game.KindLift, Time: 2 * time.Second},
+			{Index: 3, Kind: game.KindFake, Time: 2500 * time.Millisecond},
+			{Index: 0, Time: 3 * time.Second},
+		},
+	}
+}
+
+func TestPerfectBot(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+
+	scorer := score.DefaultScorer{}
+	for _, rate := range []uint16{100, 150} {
+		inputs := NewBot().Inputs(botChart(), rate)
+		result := scorer.Score(botChart(), &score.History{Inputs: &inputs, Rate: rate})
+		if result.MissCount != 0 || result.OKCount != 2 || result.NGCount != 0 || result.Wife != 100 {
+			t.Log("Rate  ", rate)
+			t.Log("Inputs", inputs)
+			t.Log("Score ", result)
+			t.Fail()
+		}
+	}
+}
+
+func TestBotWithoutReleases(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+
+	// Holds that are never let go of are OK, but lifts are never hit
+	bot := NewBot()
+	bot.Releases = false
+	inputs := bot.Inputs(botChart(), 100)
+	scorer := score.DefaultScorer{}
+	result := scorer.Score(botChart(), &score.History{Inputs: &inputs, Rate: 100})
+	if result.MissCount != 1 || result.OKCount != 2 || result.NGCount != 0 {
+		t.Log("Inputs", inputs)
+		t.Log("Score ", result)
+		t.Fail()
+	}
+}
+
+func TestHumanBot(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+
+	chart := &game.Chart{}
+	for i := 0; i < 2000; i++ {
+		chart.Notes = append(chart.Notes, &game.Note{
+			Index: uint8(i % 4),
+			Time:  time.Duration(i) * 100 * time.Millisecond,
+		})
+	}
+	bot := NewBot()
+	bot.Mean = 10 * time.Millisecond
+	bot.Stdev = 15 * time.Millisecond
+	bot.Rand = rand.New(rand.NewSource(1))
+
+	scorer := score.DefaultScorer{}
+	var sum, sumOfSquares float64
+	for _, input := range bot.Inputs(chart, 100) {
+		if input.Release {
+			continue
+		}
+		note, distance, _ := scorer.ApplyInputToChart(chart, &input, 100)
+		if nil == note {
+			t.Fatal("bot missed at", input.HitTime)
+		}
+		ms := -float64(distance) / float64(time.Millisecond)
+		sum += ms
+		sumOfSquares += ms * ms
+	}
+	n := float64(len(chart.Notes))
+	mean := sum / n
+	stdev := math.Sqrt(sumOfSquares/n - mean*mean)
+	if math.Abs(mean-10) > 1 || math.Abs(stdev-15) > 1 {
+		t.Log("Mean ", mean)
+		t.Log("Stdev", stdev)
+		t.Fail()
+	}
+}
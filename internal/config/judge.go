@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// JudgePreset is a set of timing windows that notes are judged by
+type JudgePreset struct {
+	Name       string
+	Judgements []game.Judgement // Ordered by window, with the miss last, whose window may be wider
+	Scale      float64          // Timing scale of Wife3 points, where judge 4 is 1
+}
+
+// HitWindow is the furthest from a note that it can be hit
+func (j *JudgePreset) HitWindow() time.Duration {
+	return j.Judgements[len(j.Judgements)-2].Time
+}
+
+// MissWindow is how late a note is missed, and how far from a note a press
+// still takes it, as a miss. It is the hit window unless the miss has a
+// wider window of its own.
+func (j *JudgePreset) MissWindow() time.Duration {
+	if miss := j.Judgements[len(j.Judgements)-1].Time; miss > j.HitWindow() {
+		return miss
+	}
+	return j.HitWindow()
+}
+
+// Index is the index of the judgement for a hit that is d from its note
+func (j *JudgePreset) Index(d time.Duration) int {
+	for i, judgement := range j.Judgements[:len(j.Judgements)-1] {
+		if d < judgement.Time {
+			return i
+		}
+	}
+	return len(j.Judgements) - 1
+}
+
+// Judge scales of the timing windows, from J1 to J9
+var judgeScales = []float64{1.50, 1.33, 1.16, 1.00, 0.84, 0.66, 0.50, 0.33, 0.20}
+
+var judgeColors = []rl.Color{
+	rl.NewColor(63, 0, 255, 255),
+	rl.NewColor(175, 135, 255, 255),
+	rl.NewColor(135, 215, 255, 255),
+	rl.NewColor(175, 255, 95, 255),
+	rl.NewColor(255, 175, 0, 255),
+	rl.NewColor(255, 135, 0, 255),
+	rl.NewColor(215, 0, 0, 255),
+}
+
+// judgePreset is the StepMania style preset that scales the judge 4 windows
+func judgePreset(name string, scale float64) *JudgePreset {
+	windows := []time.Duration{11, 22, 45, 90, 135, 180}
+	names := []string{"Exact", "Marvelous", "Perfect", "Great", "Good", "Boo"}
+	judgements := make([]game.Judgement, len(windows)+1)
+	for i, window := range windows {
+		judgements[i] = game.Judgement{
+			Time:  time.Duration(float64(window*time.Millisecond) * scale),
+			Name:  fmt.Sprintf("%11v", names[i]),
+			Color: judgeColors[i],
+		}
+	}
+	judgements[len(windows)] = game.Judgement{Time: -1, Name: "       Miss", Color: judgeColors[len(windows)]}
+	return &JudgePreset{Name: name, Judgements: judgements, Scale: scale}
+}
+
+// odPreset is the osu!mania preset for an overall difficulty
+func odPreset(name string, od float64) *JudgePreset {
+	windows := []float64{16, 64 - 3*od, 97 - 3*od, 127 - 3*od, 151 - 3*od}
+	names := []string{"MAX", "300", "200", "100", "50"}
+	judgements := make([]game.Judgement, len(windows)+1)
+	for i, window := range windows {
+		judgements[i] = game.Judgement{
+			Time:  time.Duration(window * float64(time.Millisecond)),
+			Name:  fmt.Sprintf("%11v", names[i]),
+			Color: judgeColors[i+1],
+		}
+	}
+	// Presses that are too early for a 50 still take the note, as a miss
+	judgements[len(windows)] = game.Judgement{
+		Time:  time.Duration((188 - 3*od) * float64(time.Millisecond)),
+		Name:  "       Miss",
+		Color: judgeColors[len(judgeColors)-1],
+	}
+	// Wife3 points are scaled by how the worst window compares to judge 4
+	return &JudgePreset{Name: name, Judgements: judgements, Scale: windows[len(windows)-1] / 180}
+}
+
+// JudgePresetFor is the preset with name, which is J1 to J9 or OD0 to OD10
+func JudgePresetFor(name string) (*JudgePreset, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	switch {
+	case strings.HasPrefix(name, "OD"):
+		od, err := strconv.ParseFloat(name[2:], 64)
+		if nil != err || od < 0 || od > 10 {
+			return nil, fmt.Errorf("invalid overall difficulty %v", name)
+		}
+		return odPreset(name, od), nil
+	case strings.HasPrefix(name, "J"):
+		j, err := strconv.Atoi(name[1:])
+		if nil != err || j < 1 || j > len(judgeScales) {
+			return nil, fmt.Errorf("invalid judge %v", name)
+		}
+		return judgePreset(name, judgeScales[j-1]), nil
+	}
+	return nil, fmt.Errorf("unknown judge preset %v", name)
+}
+
+// SetJudge judges notes by the preset with name
+func SetJudge(name string) error {
+	preset, err := JudgePresetFor(name)
+	if nil != err {
+		return err
+	}
+	Judge = preset
+	Judgements = preset.Judgements
+	return nil
+}
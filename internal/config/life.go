@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// How a run fails
+const (
+	FailNormal      = "normal"       // When the life bar empties
+	FailOff         = "off"          // Never
+	FailSuddenDeath = "sudden-death" // On the first miss
+	FailGrade       = "grade"        // Once the fail grade can no longer be reached
+)
+
+// Grade is the lowest Wife3 accuracy that earns a grade
+type Grade struct {
+	Name string
+	Wife float64
+}
+
+// Grades, from best to worst
+var Grades = []Grade{
+	{Name: "AAAAA", Wife: 99.9935},
+	{Name: "AAAA", Wife: 99.955},
+	{Name: "AAA", Wife: 99.7},
+	{Name: "AA", Wife: 93},
+	{Name: "A", Wife: 80},
+	{Name: "B", Wife: 70},
+	{Name: "C", Wife: 60},
+	{Name: "D", Wife: 0},
+}
+
+// GradeFor is the grade with name
+func GradeFor(name string) (*Grade, error) {
+	for i, grade := range Grades {
+		if strings.EqualFold(grade.Name, strings.TrimSpace(name)) {
+			return &Grades[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown grade %v", name)
+}
+
+// LifeFor is the change in life, in percent of the life bar, for a note
+// judged with judgement index. The last of LifeJudgements is for misses, and
+// the one before it is for any hit judgements that it does not cover.
+func LifeFor(index int) float64 {
+	if index >= len(Judgements)-1 {
+		return LifeJudgements[len(LifeJudgements)-1]
+	}
+	hits := LifeJudgements[:len(LifeJudgements)-1]
+	if index >= len(hits) {
+		return hits[len(hits)-1]
+	}
+	return hits[index]
+}
+
+func parseLife(values string) ([]float64, error) {
+	life := []float64{}
+	for _, value := range strings.Split(values, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if nil != err {
+			return nil, fmt.Errorf("invalid life change %v: %w", value, err)
+		}
+		life = append(life, f)
+	}
+	if len(life) < 2 {
+		return nil, fmt.Errorf("expected life changes for hits and misses, got %v", values)
+	}
+	return life, nil
+}
@@ -8,12 +8,16 @@ import (
 	"time"
 
 	"git.lost.host/meutraa/eotw/internal/game"
-	rl "github.com/gen2brain/raylib-go/raylib"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	Directory           = kingpin.Arg("directory", "Song/chart directory").Required().ExistingDir()
+	playCommand       = kingpin.Command("play", "Play a chart").Default()
+	playDirectory     = playCommand.Arg("directory", "Song/chart directory").Required().ExistingDir()
+	simulateCommand   = kingpin.Command("simulate", "Play a chart with an input file or the bot, and print the score")
+	simulateDirectory = simulateCommand.Arg("directory", "Song/chart directory").Required().ExistingDir()
+	SimulateInputs    = simulateCommand.Arg("inputs", "Input file of lines of a time in ms, a column, and press or release").ExistingFile()
+
 	Rate                = kingpin.Flag("rate", "Playback % rate").Default("100").Short('r').Uint16()
 	Offset              = kingpin.Flag("offset", "Global offset").Default("0ms").Short('o').Duration()
 	Delay               = kingpin.Flag("delay", "Start delay").Default("1.5s").Short('d').Duration()
@@ -21,34 +25,75 @@ var (
 	RefreshRate         = kingpin.Flag("refresh-rate", "Monitor refresh rate").Default("240.0").Short('R').Float()
 	NoteRadius          = kingpin.Flag("note-radius", "Radius of notes").Default("14").Float32()
 	scrollSpeedModifier = kingpin.Flag("scroll-speed", "Scroll speed, lower is faster").Default("3").Short('s').Uint()
+	keys1               = kingpin.Flag("keys-1k", "Keys for 1k").Default("32").String()
+	keys2               = kingpin.Flag("keys-2k", "Keys for 2k").Default("70,74").String()
+	keys3               = kingpin.Flag("keys-3k", "Keys for 3k").Default("70,32,74").String()
 	keys4               = kingpin.Flag("keys-single", "Keys for 4k").Default("73,69,83,67").Short('k').String()
+	keys5               = kingpin.Flag("keys-5k", "Keys for 5k").Default("68,70,32,74,75").String()
 	keys6               = kingpin.Flag("keys-solo", "Keys for 6k").Default("23,18,24,20,31,46").String()
+	keys7               = kingpin.Flag("keys-7k", "Keys for 7k").Default("83,68,70,32,74,75,76").String()
 	keys8               = kingpin.Flag("keys-double", "Keys for 8k").Default("23,18,24,49,35,20,31,46").String()
+	keys9               = kingpin.Flag("keys-9k", "Keys for 9k").Default("65,83,68,70,32,74,75,76,59").String()
+	keys10              = kingpin.Flag("keys-10k", "Keys for 10k").Default("65,83,68,70,86,78,74,75,76,59").String()
+	keysBeat5           = kingpin.Flag("keys-beat-5k", "Keys for 5k and scratch").Default("340,68,70,32,74,75").String()
+	keysBeat7           = kingpin.Flag("keys-beat-7k", "Keys for 7k and scratch").Default("340,83,68,70,32,74,75,76").String()
 	FontSize            = kingpin.Flag("font-size", "Font size").Default("24").Int32()
 	BarOffsetFromBottom = kingpin.Flag("bar-row", "Pixels from bottom to render hit bar").Default("220").Int32()
+	rollWindow          = kingpin.Flag("roll-window", "Longest gap between roll taps").Default("350ms").Duration()
+	holdWindow          = kingpin.Flag("hold-window", "Longest a hold can be let go of").Default("250ms").Duration()
+	mineWindow          = kingpin.Flag("mine-window", "How close to a mine a held key hits it").Default("75ms").Duration()
+	Difficulty          = kingpin.Flag("difficulty", "Difficulty to play, by name or by index in --list").Short('D').String()
+	Meter               = kingpin.Flag("meter", "Meter of the difficulty to play").Short('m').String()
+	List                = kingpin.Flag("list", "List the charts in the directory and exit").Short('l').Bool()
+	Rescan              = kingpin.Flag("rescan", "Parse every song of a songs directory again, rather than only the changed ones").Bool()
+	judge               = kingpin.Flag("judge", "Timing windows, J1 to J9 or osu!mania OD0 to OD10").Default("J4").Short('j').String()
+	Replay              = kingpin.Flag("replay", "Watch the score with this id").Int64()
+	Autoplay            = kingpin.Flag("autoplay", "Let a bot play the chart").Short('a').Bool()
+	AutoplayMean        = kingpin.Flag("autoplay-mean", "Mean offset of the bot's hits").Default("0ms").Duration()
+	AutoplayStdev       = kingpin.Flag("autoplay-stdev", "Standard deviation of the bot's hits").Default("0ms").Duration()
+	AutoplayReleases    = kingpin.Flag("autoplay-releases", "Whether the bot releases keys").Default("true").Bool()
+	fail                = kingpin.Flag("fail", "When a run fails: normal, off, sudden-death or grade").Default(FailNormal).Enum(FailNormal, FailOff, FailSuddenDeath, FailGrade)
+	failGrade           = kingpin.Flag("fail-grade", "Grade that --fail=grade fails below").Default("A").String()
+	lifeJudgements      = kingpin.Flag("life", "Life bar % change for each judgement, best first, with misses last").Default("0.8,0.8,0.8,0.4,0,-4,-8").String()
+	lifeMine            = kingpin.Flag("life-mine", "Life bar % change for hitting a mine").Default("-16").Float64()
+	lifeHoldOK          = kingpin.Flag("life-hold-ok", "Life bar % change for a hold or roll kept until its end").Default("0.8").Float64()
+	lifeHoldNG          = kingpin.Flag("life-hold-ng", "Life bar % change for a dropped hold or roll").Default("-8").Float64()
+	PauseKey            = kingpin.Flag("pause-key", "Key to pause and resume").Default("258").Int32()
+	RestartKey          = kingpin.Flag("restart-key", "Key to restart the chart").Default("96").Int32()
+	LeadIn              = kingpin.Flag("lead-in", "How much of the chart before a pause is played again on resume").Default("2s").Duration()
+	Evdev               = kingpin.Flag("evdev", "Keyboards to read timestamped keys from, auto, or off to read keys each frame").Default("auto").String()
 	BarSym              = kingpin.Flag("bar-decoration", "Decoration at the hitfield").Default("\033[2m\033[1D[ ]").String()
 
-	Keys4       [4]int32
-	Keys6       [6]int32
-	Keys8       [8]int32
-	PixelsPerNs float64
-	Judgements  []game.Judgement
+	Simulate       bool    // Whether the command was simulate
+	Directory      *string // Song/chart directory of the command
+	KeyLayouts     = map[uint8][]int32{}
+	TypeLayouts    = map[string][]int32{} // Layouts for chart types that share a key count
+	PixelsPerNs    float64
+	Judgements     []game.Judgement
+	Judge          *JudgePreset
+	Fail           = FailNormal
+	FailAt         = &Grades[4]
+	LifeJudgements = []float64{0.8, 0.8, 0.8, 0.4, 0, -4, -8}
+	LifeMine       = -16.0
+	LifeHoldOK     = 0.8
+	LifeHoldNG     = -8.0
+	RollWindow     = 350 * time.Millisecond
+	HoldWindow     = 250 * time.Millisecond
+	MineWindow     = 75 * time.Millisecond
 )
 
-func Keys(nKeys uint8) []int32 {
-	switch nKeys {
-	case 4:
-		return Keys4[:]
-	case 6:
-		return Keys6[:]
-	case 8:
-		return Keys8[:]
+func Keys(chartType string, nKeys uint8) []int32 {
+	if keys, ok := TypeLayouts[chartType]; ok {
+		return keys
+	}
+	if keys, ok := KeyLayouts[nKeys]; ok {
+		return keys
 	}
-	return Keys4[:]
+	return KeyLayouts[4]
 }
 
-func KeyColumn(r int32, nKeys uint8) (uint8, error) {
-	for i, c := range Keys(nKeys) {
+func KeyColumn(r int32, chartType string, nKeys uint8) (uint8, error) {
+	for i, c := range Keys(chartType, nKeys) {
 		if r == c {
 			return uint8(i), nil
 		}
@@ -56,48 +101,57 @@ func KeyColumn(r int32, nKeys uint8) (uint8, error) {
 	return 0, errors.New("key not mapped to index")
 }
 
-func Init() {
-	kingpin.Version("0.2.0")
-	kingpin.Parse()
-
-	keys := strings.Split(*keys4, ",")
+func parseKeys(layout string, nKeys uint8) []int32 {
+	keys := strings.Split(layout, ",")
+	if len(keys) != int(nKeys) {
+		log.Fatalf("expected %v keys for %vk, got %v\n", nKeys, nKeys, len(keys))
+	}
+	codes := make([]int32, nKeys)
 	for i, key := range keys {
 		p, err := strconv.ParseInt(key, 10, 32)
 		if nil != err {
 			log.Fatalln(err)
 		}
-		Keys4[i] = int32(p)
+		codes[i] = int32(p)
+	}
+	return codes
+}
+
+func Init() {
+	kingpin.Version("0.2.0")
+	Simulate = kingpin.Parse() == simulateCommand.FullCommand()
+	Directory = playDirectory
+	if Simulate {
+		Directory = simulateDirectory
+	}
+
+	layouts := map[uint8]*string{
+		1: keys1, 2: keys2, 3: keys3, 4: keys4, 5: keys5,
+		6: keys6, 7: keys7, 8: keys8, 9: keys9, 10: keys10,
+	}
+	for nKeys, layout := range layouts {
+		KeyLayouts[nKeys] = parseKeys(*layout, nKeys)
 	}
+	TypeLayouts["beat-5k"] = parseKeys(*keysBeat5, game.NKeyMap["beat-5k"])
+	TypeLayouts["beat-7k"] = parseKeys(*keysBeat7, game.NKeyMap["beat-7k"])
 
+	RollWindow = *rollWindow
+	HoldWindow = *holdWindow
+	MineWindow = *mineWindow
 	PixelsPerNs = 1 / (float64(*scrollSpeedModifier) * 40 / *RefreshRate * 1000000)
-	Judgements = []game.Judgement{
-		{Time: 11 * time.Millisecond,
-			Name:  "      Exact",
-			Color: rl.NewColor(63, 0, 255, 255),
-		},
-		{Time: 22 * time.Millisecond,
-			Name:  "  Marvelous",
-			Color: rl.NewColor(175, 135, 255, 255),
-		},
-		{Time: 45 * time.Millisecond,
-			Name:  "    Perfect",
-			Color: rl.NewColor(135, 215, 255, 255),
-		},
-		{Time: 90 * time.Millisecond,
-			Name:  "      Great",
-			Color: rl.NewColor(175, 255, 95, 255),
-		},
-		{Time: 135 * time.Millisecond,
-			Name:  "       Good",
-			Color: rl.NewColor(255, 175, 0, 255),
-		},
-		{Time: 180 * time.Millisecond,
-			Name:  "        Boo",
-			Color: rl.NewColor(255, 135, 0, 255),
-		},
-		{Time: -1,
-			Name:  "       Miss",
-			Color: rl.NewColor(215, 0, 0, 255),
-		},
+	if err := SetJudge(*judge); nil != err {
+		log.Fatalln(err)
+	}
+	Fail = *fail
+	LifeMine = *lifeMine
+	LifeHoldOK = *lifeHoldOK
+	LifeHoldNG = *lifeHoldNG
+	grade, err := GradeFor(*failGrade)
+	if nil != err {
+		log.Fatalln(err)
+	}
+	FailAt = grade
+	if LifeJudgements, err = parseLife(*lifeJudgements); nil != err {
+		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,66 @@
+// Package evdev reads key events from Linux input devices, with the
+// kernel's timestamps of when they happened
+package evdev
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/play"
+)
+
+// Keyboards are the paths of the keyboard devices
+func Keyboards() []string {
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range []string{"/dev/input/by-path/*-event-kbd", "/dev/input/by-id/*-event-kbd"} {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			device, err := filepath.EvalSymlinks(match)
+			if nil != err || seen[device] {
+				continue
+			}
+			seen[device] = true
+			paths = append(paths, device)
+		}
+	}
+	return paths
+}
+
+// Listen sends the key events of devices to events until they can not be
+// read. Devices is a comma separated list of paths, auto for every
+// keyboard, or off to not listen.
+func Listen(devices string, events chan<- play.KeyEvent) error {
+	var paths []string
+	switch devices {
+	case "off":
+		return errors.New("evdev is off")
+	case "auto":
+		paths = Keyboards()
+	default:
+		paths = strings.Split(devices, ",")
+	}
+
+	opened := 0
+	for _, path := range paths {
+		device, err := Open(path)
+		if nil != err {
+			log.Println("unable to open keyboard", err)
+			continue
+		}
+		opened++
+		go func() {
+			defer device.Close()
+			if err := device.Read(events); nil != err {
+				log.Println("unable to read keyboard", err)
+			}
+		}()
+	}
+	if opened == 0 {
+		return fmt.Errorf("no keyboards could be opened from %v", paths)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package evdev
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"git.lost.host/meutraa/eotw/internal/play"
+)
+
+const (
+	evKey          = 0x01
+	evioSClockID   = 0x400445a0 // _IOW('E', 0xa0, int)
+	clockMonotonic = 1
+	valueRelease   = 0
+	valuePress     = 1
+)
+
+// inputEvent is struct input_event of linux/input.h
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// Device is an input device that key events are read from
+type Device struct {
+	file      *os.File
+	monotonic bool // Whether events are timestamped by the monotonic clock
+}
+
+// Open opens the input device at path, and asks for its events to be
+// timestamped by the monotonic clock, which does not jump with the date
+func Open(path string) (*Device, error) {
+	file, err := os.Open(path)
+	if nil != err {
+		return nil, err
+	}
+	clock := int32(clockMonotonic)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), evioSClockID, uintptr(unsafe.Pointer(&clock)))
+	return &Device{file: file, monotonic: errno == 0}, nil
+}
+
+func (d *Device) Close() error {
+	return d.file.Close()
+}
+
+// Read sends the key presses and releases of the device to events, until
+// it can not be read
+func (d *Device) Read(events chan<- play.KeyEvent) error {
+	for {
+		var event inputEvent
+		if err := binary.Read(d.file, binary.LittleEndian, &event); nil != err {
+			return err
+		}
+		// Key repeats are ignored
+		if event.Type != evKey || (event.Value != valuePress && event.Value != valueRelease) {
+			continue
+		}
+		key, ok := keys[event.Code]
+		if !ok {
+			continue
+		}
+		events <- play.KeyEvent{Key: key, Release: event.Value == valueRelease, Time: d.time(event.Time)}
+	}
+}
+
+// time is when an event with timestamp tv happened
+func (d *Device) time(tv syscall.Timeval) time.Time {
+	at := time.Duration(tv.Nano())
+	if !d.monotonic {
+		return time.Unix(0, int64(at))
+	}
+	var ts syscall.Timespec
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0)
+	return time.Now().Add(at - time.Duration(ts.Nano()))
+}
@@ -0,0 +1,64 @@
+package evdev
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/play"
+)
+
+func TestRead(t *testing.T) {
+	file, err := ioutil.TempFile("", "eotw-evdev")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	at := func(ms int64) syscall.Timeval { return syscall.NsecToTimeval(ms * int64(time.Millisecond)) }
+	for _, event := range []inputEvent{
+		{Time: at(1000), Type: evKey, Code: 30, Value: valuePress},
+		{Time: at(1000), Type: 0, Code: 0, Value: 0},
+		{Time: at(1200), Type: evKey, Code: 30, Value: 2},
+		{Time: at(1300), Type: evKey, Code: 248, Value: valuePress},
+		{Time: at(1400), Type: evKey, Code: 30, Value: valueRelease},
+	} {
+		binary.Write(file, binary.LittleEndian, event)
+	}
+	file.Close()
+
+	// A regular file has no clock to set, so its times are the date's
+	device, err := Open(file.Name())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	events := make(chan play.KeyEvent, 8)
+	if err := device.Read(events); err != io.EOF {
+		t.Fatal("Expected to read until the end, got", err)
+	}
+	close(events)
+
+	expected := []play.KeyEvent{
+		{Key: 65, Time: time.Unix(1, 0)},
+		{Key: 65, Time: time.Unix(1, int64(400*time.Millisecond)), Release: true},
+	}
+	read := []play.KeyEvent{}
+	for event := range events {
+		read = append(read, event)
+	}
+	if len(read) != len(expected) {
+		t.Fatal("Expected", expected, "got", read)
+	}
+	for i := range expected {
+		if read[i].Key != expected[i].Key || read[i].Release != expected[i].Release || !read[i].Time.Equal(expected[i].Time) {
+			t.Log("Event   ", read[i])
+			t.Log("Expected", expected[i])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package evdev
+
+import (
+	"errors"
+
+	"git.lost.host/meutraa/eotw/internal/play"
+)
+
+// Device is an input device that key events are read from
+type Device struct{}
+
+// Open only opens devices on Linux
+func Open(path string) (*Device, error) {
+	return nil, errors.New("evdev is only on linux")
+}
+
+func (d *Device) Close() error {
+	return nil
+}
+
+func (d *Device) Read(events chan<- play.KeyEvent) error {
+	return errors.New("evdev is only on linux")
+}
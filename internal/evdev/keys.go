@@ -0,0 +1,46 @@
+package evdev
+
+// keys are the raylib key codes of the evdev key codes
+var keys = map[uint16]int32{
+	1: 256, // Escape
+	2: 49, 3: 50, 4: 51, 5: 52, 6: 53, 7: 54, 8: 55, 9: 56, 10: 57, 11: 48,
+	12: 45,  // Minus
+	13: 61,  // Equal
+	14: 259, // Backspace
+	15: 258, // Tab
+	16: 81, 17: 87, 18: 69, 19: 82, 20: 84, 21: 89, 22: 85, 23: 73, 24: 79, 25: 80,
+	26: 91,  // Left bracket
+	27: 93,  // Right bracket
+	28: 257, // Enter
+	29: 341, // Left control
+	30: 65, 31: 83, 32: 68, 33: 70, 34: 71, 35: 72, 36: 74, 37: 75, 38: 76,
+	39: 59,  // Semicolon
+	40: 39,  // Apostrophe
+	41: 96,  // Grave
+	42: 340, // Left shift
+	43: 92,  // Backslash
+	44: 90, 45: 88, 46: 67, 47: 86, 48: 66, 49: 78, 50: 77,
+	51: 44,                    // Comma
+	52: 46,                    // Period
+	53: 47,                    // Slash
+	54: 344,                   // Right shift
+	55: 332,                   // Keypad multiply
+	56: 342,                   // Left alt
+	57: 32,                    // Space
+	58: 280,                   // Caps lock
+	71: 327, 72: 328, 73: 329, // Keypad 7, 8, 9
+	74: 333,                   // Keypad subtract
+	75: 324, 76: 325, 77: 326, // Keypad 4, 5, 6
+	78: 334,                   // Keypad add
+	79: 321, 80: 322, 81: 323, // Keypad 1, 2, 3
+	82:  320, // Keypad 0
+	83:  330, // Keypad decimal
+	96:  335, // Keypad enter
+	97:  345, // Right control
+	98:  331, // Keypad divide
+	100: 346, // Right alt
+	103: 265, // Up
+	105: 263, // Left
+	106: 262, // Right
+	108: 264, // Down
+}
@@ -7,6 +7,8 @@ type Chart struct {
 	HoldCount  int64
 	MineCount  int64
 	Difficulty Difficulty
+	Timing     *TimingData
+	Song       *Song
 
 	// This is for rendering optimization
 	NoteCountsAsStrings []string
@@ -19,6 +21,8 @@ type Chart struct {
 	activeMeasures    []*Measure
 	startMeasureIndex int
 	endMeasureIndex   int
+
+	columns map[uint8]*Column
 }
 
 func (c *Chart) Active() ([]*Note, int, int) {
@@ -31,6 +35,22 @@ func (c *Chart) SetActive(start int, end int) {
 	c.endNoteIndex = end
 }
 
+// Reset forgets the state of playing the chart, so it can be played again
+func (c *Chart) Reset() {
+	for _, note := range c.Notes {
+		note.HitTime = 0
+		note.Judgement = nil
+		note.ReleaseTime = 0
+		note.MissTime = 0
+		note.RollTime = 0
+		note.DropTime = 0
+		note.Hold = HoldPending
+	}
+	c.SetActive(0, 0)
+	c.SetActiveMeasures(0, 0)
+	c.columns = nil
+}
+
 func (c *Chart) ActiveMeasures() ([]*Measure, int, int) {
 	return c.activeMeasures, c.startMeasureIndex, c.endMeasureIndex
 }
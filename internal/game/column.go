@@ -0,0 +1,55 @@
+package game
+
+import "sort"
+
+// Column is the notes of one column of a chart in time order, for looking
+// up the notes that an input could hit without going through every note
+type Column struct {
+	Notes []*Note
+	Holds []*Note // The holds and rolls in Notes
+
+	next int // Notes before this have all been judged, or are never judged
+}
+
+// Column is the notes in column index, which are indexed the first time any
+// column is asked for
+func (c *Chart) Column(index uint8) *Column {
+	if nil == c.columns {
+		c.columns = map[uint8]*Column{}
+		for _, note := range c.Notes {
+			column, ok := c.columns[note.Index]
+			if !ok {
+				column = &Column{}
+				c.columns[note.Index] = column
+			}
+			column.Notes = append(column.Notes, note)
+		}
+		for _, column := range c.columns {
+			sort.SliceStable(column.Notes, func(i, j int) bool { return column.Notes[i].Time < column.Notes[j].Time })
+			for _, note := range column.Notes {
+				if note.TimeEnd != 0 {
+					column.Holds = append(column.Holds, note)
+				}
+			}
+		}
+	}
+	if column, ok := c.columns[index]; ok {
+		return column
+	}
+	return &Column{}
+}
+
+// Pending is the notes from the first judged note that has not been hit or
+// missed. Notes are mostly judged in order, so this skips everything that
+// was played.
+func (c *Column) Pending() []*Note {
+	for c.next < len(c.Notes) && c.Notes[c.next].isDone() {
+		c.next++
+	}
+	return c.Notes[c.next:]
+}
+
+// isDone is whether the note was hit or missed, or is never judged
+func (n *Note) isDone() bool {
+	return n.HitTime != 0 || n.MissTime != 0 || !n.IsJudged()
+}
@@ -0,0 +1,24 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestColumnPending(t *testing.T) {
+	chart := &Chart{}
+	for i := 0; i < 5; i++ {
+		chart.Notes = append(chart.Notes, &Note{Time: time.Duration(i) * time.Second})
+	}
+	chart.Notes[0].HitTime = 1
+	chart.Notes[1].MissTime = 1
+	chart.Notes[2].Kind = KindFake
+	chart.Notes[4].MissTime = 1
+
+	// Hit, missed and unjudged notes are skipped until one is left to play
+	column := chart.Column(0)
+	if pending := column.Pending(); len(pending) != 2 || pending[0] != chart.Notes[3] || column.next != 3 {
+		t.Log("Pending", pending, column.next)
+		t.Fail()
+	}
+}
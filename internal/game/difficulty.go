@@ -1,14 +1,32 @@
 package game
 
+import "fmt"
+
 type Difficulty struct {
+	Type    string // The chart type, a key of NKeyMap
 	Name    string
 	Msd     string
 	Section string
 	NKeys   uint8
 }
 
+// NKeyMap is the number of columns for each supported chart type
 var NKeyMap = map[string]uint8{
 	"dance-single": 4,
 	"dance-solo":   6,
 	"dance-double": 8,
+	"beat-5k":      6, // 5 keys and a scratch
+	"beat-7k":      8, // 7 keys and a scratch
+	"popn-9k":      9,
+}
+
+// ManiaKeyMode is the chart type of an osu!mania chart with nKeys columns
+func ManiaKeyMode(nKeys uint8) string {
+	return fmt.Sprintf("mania-%vk", nKeys)
+}
+
+func init() {
+	for n := uint8(1); n <= 10; n++ {
+		NKeyMap[ManiaKeyMode(n)] = n
+	}
 }
@@ -5,4 +5,5 @@ import "time"
 type Input struct {
 	Index   uint8 // game column index
 	HitTime time.Duration
+	Release bool // Whether the key was released rather than pressed
 }
@@ -4,16 +4,54 @@ import (
 	"time"
 )
 
+type NoteKind uint8
+
+const (
+	KindTap      NoteKind = iota
+	KindHold              // Held from Time until TimeEnd
+	KindRoll              // Tapped repeatedly from Time until TimeEnd
+	KindMine              // Must not be pressed
+	KindLift              // Hit by releasing the key
+	KindFake              // Drawn but never judged
+	KindKeysound          // Only plays a sample
+)
+
+// HoldJudgement is the result of a hold or roll once it has been hit
+type HoldJudgement uint8
+
+const (
+	HoldPending HoldJudgement = iota
+	HoldOK                    // Held until its end
+	HoldNG                    // Let go of for too long before its end
+)
+
 type Note struct {
-	Index   uint8 // The chart column
-	Denom   int   // The beat length, as a denominator, 4 = 1/4 beat
-	IsMine  bool
-	Time    time.Duration // The time the note should be hit
-	TimeEnd time.Duration // The time the note should be unhit
+	Index    uint8 // The chart column
+	Denom    int   // The beat length, as a denominator, 4 = 1/4 beat
+	Kind     NoteKind
+	Time     time.Duration // The time the note should be hit
+	TimeEnd  time.Duration // The time the note should be unhit
+	Keysound string        // The sample for this note, if the chart has one
 
 	// This is state
 	HitTime     time.Duration // When the note was hit
 	Judgement   *Judgement
-	ReleaseTime time.Duration // When the note was released
+	ReleaseTime time.Duration // When a hold was let go of, or 0 while it is held
 	MissTime    time.Duration // When the note was missed
+	RollTime    time.Duration // When a roll was last tapped
+	DropTime    time.Duration // When a hold or roll was dropped
+	Hold        HoldJudgement
+}
+
+func (n *Note) IsMine() bool {
+	return n.Kind == KindMine
+}
+
+// IsJudged is whether the note is judged when it is hit or missed
+func (n *Note) IsJudged() bool {
+	switch n.Kind {
+	case KindMine, KindFake, KindKeysound:
+		return false
+	}
+	return true
 }
@@ -0,0 +1,37 @@
+package game
+
+import "time"
+
+// Song is the metadata shared by every chart of a song
+type Song struct {
+	Title    string
+	Subtitle string
+	Artist   string
+
+	// Romanised versions of the above, for titles in other scripts
+	TitleTranslit    string
+	SubtitleTranslit string
+	ArtistTranslit   string
+
+	Credit string // Who made the charts
+
+	// Paths to the song files, empty when the chart does not name one
+	Music      string
+	Banner     string
+	Background string
+
+	// The song is only the keysounds of the notes, and has no music
+	Keysounded bool
+
+	// The part of the music to play as a preview
+	SampleStart  time.Duration
+	SampleLength time.Duration
+}
+
+// FullTitle is the title followed by the subtitle, if there is one
+func (s *Song) FullTitle() string {
+	if s.Subtitle == "" {
+		return s.Title
+	}
+	return s.Title + " " + s.Subtitle
+}
@@ -0,0 +1,13 @@
+package game
+
+// Stop pauses the chart for Duration seconds after the notes on StartingBeat
+type Stop struct {
+	StartingBeat float64
+	Duration     float64
+}
+
+// Delay pauses the chart for Duration seconds before the notes on StartingBeat
+type Delay struct {
+	StartingBeat float64
+	Duration     float64
+}
@@ -0,0 +1,347 @@
+package game
+
+import (
+	"sort"
+	"time"
+)
+
+// Warp skips Length beats starting at StartingBeat, taking no time at all
+type Warp struct {
+	StartingBeat float64
+	Length       float64
+}
+
+// Scroll scales how fast the chart scrolls from StartingBeat onwards
+type Scroll struct {
+	StartingBeat float64
+	Ratio        float64
+}
+
+// Speed eases the scroll speed multiplier to Ratio over Duration, which is in
+// seconds when InSeconds is set and otherwise in beats
+type Speed struct {
+	StartingBeat float64
+	Ratio        float64
+	Duration     float64
+	InSeconds    bool
+}
+
+// Fake marks Length beats from StartingBeat as never being judged
+type Fake struct {
+	StartingBeat float64
+	Length       float64
+}
+
+// Rows are placed on fractional beats, so allow for some error when
+// matching a row to the beat of a stop or delay
+const beatEpsilon = 0.0005
+
+// A timingSegment is a span of beats with a constant tempo. Its start time
+// does not include any stops or delays.
+type timingSegment struct {
+	beat           float64
+	seconds        float64
+	secondsPerBeat float64 // 0 while warping
+}
+
+// A scrollSegment is a span of time scrolling at a constant ratio, with the
+// scrolled distance at its start
+type scrollSegment struct {
+	seconds  float64
+	position float64
+	ratio    float64
+}
+
+// A timingPause is a stop or a delay with the total pause time before it
+type timingPause struct {
+	beat     float64
+	seconds  float64 // time the pause starts, including earlier pauses
+	duration float64
+	before   float64 // sum of every earlier pause duration
+	isDelay  bool
+}
+
+// TimingData converts between beats and chart time. Segment start times
+// are computed once, so lookups are a binary search and do not accumulate
+// error over the length of a chart.
+type TimingData struct {
+	Offset float64 // Time of beat 0 in seconds
+	BPMs   []BPM
+	Stops  []Stop
+	Delays []Delay
+	Warps  []Warp
+
+	// These only change how the chart is drawn
+	Scrolls []Scroll
+	Speeds  []Speed
+	Fakes   []Fake
+
+	segments []timingSegment
+	pauses   []timingPause
+	scrolls  []scrollSegment
+}
+
+func NewTimingData(offset float64, bpms []BPM, stops []Stop, delays []Delay, warps []Warp) *TimingData {
+	t := &TimingData{
+		Offset: offset,
+		BPMs:   append([]BPM{}, bpms...),
+		Stops:  append([]Stop{}, stops...),
+		Delays: append([]Delay{}, delays...),
+		Warps:  append([]Warp{}, warps...),
+	}
+	t.Init()
+	return t
+}
+
+// Init sorts the timing events and precomputes the lookups, and must be
+// called after any of the exported fields are changed
+func (t *TimingData) Init() {
+	sort.SliceStable(t.BPMs, func(i, j int) bool { return t.BPMs[i].StartingBeat < t.BPMs[j].StartingBeat })
+	sort.SliceStable(t.Stops, func(i, j int) bool { return t.Stops[i].StartingBeat < t.Stops[j].StartingBeat })
+	sort.SliceStable(t.Delays, func(i, j int) bool { return t.Delays[i].StartingBeat < t.Delays[j].StartingBeat })
+	sort.SliceStable(t.Warps, func(i, j int) bool { return t.Warps[i].StartingBeat < t.Warps[j].StartingBeat })
+	sort.SliceStable(t.Scrolls, func(i, j int) bool { return t.Scrolls[i].StartingBeat < t.Scrolls[j].StartingBeat })
+	sort.SliceStable(t.Speeds, func(i, j int) bool { return t.Speeds[i].StartingBeat < t.Speeds[j].StartingBeat })
+	sort.SliceStable(t.Fakes, func(i, j int) bool { return t.Fakes[i].StartingBeat < t.Fakes[j].StartingBeat })
+	t.buildSegments()
+	t.buildPauses()
+	t.buildScrolls()
+}
+
+func (t *TimingData) buildSegments() {
+	// Every beat where the tempo or warp state changes starts a segment
+	beats := []float64{}
+	for _, bpm := range t.BPMs {
+		beats = append(beats, bpm.StartingBeat)
+	}
+	for _, warp := range t.Warps {
+		beats = append(beats, warp.StartingBeat, warp.StartingBeat+warp.Length)
+	}
+	sort.Float64s(beats)
+
+	bpmAt := func(beat float64) float64 {
+		value := 60.0
+		for _, bpm := range t.BPMs {
+			if bpm.StartingBeat > beat {
+				break
+			}
+			value = bpm.Value
+		}
+		return value
+	}
+	warpedAt := func(beat float64) bool {
+		for _, warp := range t.Warps {
+			if beat >= warp.StartingBeat && beat < warp.StartingBeat+warp.Length {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.segments = nil
+	seconds := 0.0
+	for i, beat := range beats {
+		if i > 0 && beat == beats[i-1] {
+			continue
+		}
+		if n := len(t.segments); n > 0 {
+			last := t.segments[n-1]
+			seconds = last.seconds + (beat-last.beat)*last.secondsPerBeat
+		}
+		spb := 60.0 / bpmAt(beat)
+		if warpedAt(beat) {
+			spb = 0
+		}
+		t.segments = append(t.segments, timingSegment{
+			beat:           beat,
+			seconds:        seconds,
+			secondsPerBeat: spb,
+		})
+	}
+	if len(t.segments) == 0 {
+		t.segments = append(t.segments, timingSegment{secondsPerBeat: 1})
+	}
+}
+
+func (t *TimingData) buildPauses() {
+	t.pauses = make([]timingPause, 0, len(t.Stops)+len(t.Delays))
+	for _, stop := range t.Stops {
+		t.pauses = append(t.pauses, timingPause{beat: stop.StartingBeat, duration: stop.Duration})
+	}
+	for _, delay := range t.Delays {
+		t.pauses = append(t.pauses, timingPause{beat: delay.StartingBeat, duration: delay.Duration, isDelay: true})
+	}
+	// A delay happens before the notes on its beat, and a stop after them
+	sort.SliceStable(t.pauses, func(i, j int) bool {
+		if t.pauses[i].beat != t.pauses[j].beat {
+			return t.pauses[i].beat < t.pauses[j].beat
+		}
+		return t.pauses[i].isDelay && !t.pauses[j].isDelay
+	})
+	before := 0.0
+	for i := range t.pauses {
+		t.pauses[i].before = before
+		t.pauses[i].seconds = t.beatSeconds(t.pauses[i].beat) + before
+		before += t.pauses[i].duration
+	}
+}
+
+func (t *TimingData) buildScrolls() {
+	t.scrolls = nil
+	for _, scroll := range t.Scrolls {
+		seconds := t.BeatSeconds(scroll.StartingBeat)
+		position := seconds
+		if n := len(t.scrolls); n > 0 {
+			last := t.scrolls[n-1]
+			position = last.position + (seconds-last.seconds)*last.ratio
+		}
+		t.scrolls = append(t.scrolls, scrollSegment{
+			seconds:  seconds,
+			position: position,
+			ratio:    scroll.Ratio,
+		})
+	}
+}
+
+// beatSeconds is the time of beat relative to the offset, ignoring pauses
+func (t *TimingData) beatSeconds(beat float64) float64 {
+	i := sort.Search(len(t.segments), func(i int) bool { return t.segments[i].beat > beat }) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := t.segments[i]
+	if seg.secondsPerBeat == 0 && beat < seg.beat {
+		// Before a chart that starts warping, assume the first tempo
+		return seg.seconds + (beat-seg.beat)*60.0/t.firstBPM()
+	}
+	return seg.seconds + (beat-seg.beat)*seg.secondsPerBeat
+}
+
+func (t *TimingData) firstBPM() float64 {
+	if len(t.BPMs) == 0 {
+		return 60.0
+	}
+	return t.BPMs[0].Value
+}
+
+// pausedSeconds is the sum of every pause that has elapsed by the time the
+// notes on beat are hit
+func (t *TimingData) pausedSeconds(beat float64) float64 {
+	i := sort.Search(len(t.pauses), func(i int) bool {
+		p := t.pauses[i]
+		if p.isDelay {
+			return p.beat >= beat+beatEpsilon
+		}
+		return p.beat >= beat-beatEpsilon
+	})
+	if i == len(t.pauses) {
+		if i == 0 {
+			return 0
+		}
+		return t.pauses[i-1].before + t.pauses[i-1].duration
+	}
+	return t.pauses[i].before
+}
+
+// BeatSeconds is the time in seconds that the notes on beat should be hit
+func (t *TimingData) BeatSeconds(beat float64) float64 {
+	return t.Offset + t.beatSeconds(beat) + t.pausedSeconds(beat)
+}
+
+// BeatToTime is the time that the notes on beat should be hit
+func (t *TimingData) BeatToTime(beat float64) time.Duration {
+	return time.Duration(t.BeatSeconds(beat) * 1000 * 1000 * 1000)
+}
+
+// TimeToBeat is the beat that the chart is scrolled to at time d
+func (t *TimingData) TimeToBeat(d time.Duration) float64 {
+	seconds := d.Seconds() - t.Offset
+
+	// Remove the pauses that have elapsed, or freeze on the current one
+	i := sort.Search(len(t.pauses), func(i int) bool { return t.pauses[i].seconds > seconds }) - 1
+	if i >= 0 {
+		p := t.pauses[i]
+		if seconds < p.seconds+p.duration {
+			return p.beat
+		}
+		seconds -= p.before + p.duration
+	}
+
+	// Find the last segment that has started and takes time to scroll
+	j := sort.Search(len(t.segments), func(j int) bool { return t.segments[j].seconds > seconds }) - 1
+	for ; j > 0 && t.segments[j].secondsPerBeat == 0; j-- {
+	}
+	if j < 0 {
+		j = 0
+	}
+	seg := t.segments[j]
+	if seg.secondsPerBeat == 0 {
+		return seg.beat + (seconds-seg.seconds)*t.firstBPM()/60.0
+	}
+	return seg.beat + (seconds-seg.seconds)/seg.secondsPerBeat
+}
+
+// ScrollPosition is how far the chart has scrolled by time d, measured in
+// the time it would take to scroll that far at a ratio of 1
+func (t *TimingData) ScrollPosition(d time.Duration) time.Duration {
+	seconds := d.Seconds()
+	i := sort.Search(len(t.scrolls), func(i int) bool { return t.scrolls[i].seconds > seconds }) - 1
+	if i < 0 {
+		return d
+	}
+	seg := t.scrolls[i]
+	return time.Duration((seg.position + (seconds-seg.seconds)*seg.ratio) * 1000 * 1000 * 1000)
+}
+
+// SpeedAt is the scroll speed multiplier at time d
+func (t *TimingData) SpeedAt(d time.Duration) float64 {
+	if len(t.Speeds) == 0 {
+		return 1
+	}
+	beat := t.TimeToBeat(d)
+	from := 1.0
+	for i, speed := range t.Speeds {
+		if speed.StartingBeat > beat {
+			break
+		}
+		if i+1 < len(t.Speeds) && t.Speeds[i+1].StartingBeat <= beat {
+			from = speed.Ratio
+			continue
+		}
+
+		// Ease from the previous ratio while this change is in progress
+		progress := 1.0
+		if speed.InSeconds && speed.Duration > 0 {
+			progress = (d.Seconds() - t.BeatSeconds(speed.StartingBeat)) / speed.Duration
+		} else if speed.Duration > 0 {
+			progress = (beat - speed.StartingBeat) / speed.Duration
+		}
+		if progress >= 1 {
+			return speed.Ratio
+		}
+		return from + (speed.Ratio-from)*progress
+	}
+	return from
+}
+
+// IsFake is whether the notes on beat are never judged, either because they
+// are in a fake section or are skipped by a warp
+func (t *TimingData) IsFake(beat float64) bool {
+	for _, warp := range t.Warps {
+		if warp.StartingBeat > beat+beatEpsilon {
+			break
+		}
+		if beat > warp.StartingBeat+beatEpsilon && beat < warp.StartingBeat+warp.Length-beatEpsilon {
+			return true
+		}
+	}
+	for _, fake := range t.Fakes {
+		if fake.StartingBeat > beat+beatEpsilon {
+			break
+		}
+		if beat < fake.StartingBeat+fake.Length-beatEpsilon {
+			return true
+		}
+	}
+	return false
+}
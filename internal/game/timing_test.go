@@ -0,0 +1,66 @@
+package game
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var timingTests = []struct {
+	Beat float64
+	Time time.Duration
+}{
+	{Beat: -1, Time: -500 * time.Millisecond},
+	{Beat: 0, Time: 0},
+	{Beat: 2, Time: 1000 * time.Millisecond},  // stop of 1s after this
+	{Beat: 3, Time: 2250 * time.Millisecond},  // 240bpm from beat 2
+	{Beat: 4, Time: 2500 * time.Millisecond},  // warp to beat 6
+	{Beat: 6, Time: 2500 * time.Millisecond},  // end of warp
+	{Beat: 8, Time: 3500 * time.Millisecond},  // delay of 0.5s before this
+	{Beat: 10, Time: 4000 * time.Millisecond}, // 240bpm
+}
+
+func newTestTiming() *TimingData {
+	return NewTimingData(0,
+		[]BPM{{StartingBeat: 2, Value: 240}, {StartingBeat: 0, Value: 120}},
+		[]Stop{{StartingBeat: 2, Duration: 1}},
+		[]Delay{{StartingBeat: 8, Duration: 0.5}},
+		[]Warp{{StartingBeat: 4, Length: 2}},
+	)
+}
+
+func TestBeatToTime(t *testing.T) {
+	timing := newTestTiming()
+	for _, test := range timingTests {
+		if d := timing.BeatToTime(test.Beat); d != test.Time {
+			t.Log("Beat    ", test.Beat)
+			t.Log("Time    ", d)
+			t.Log("Expected", test.Time)
+			t.Fail()
+		}
+	}
+}
+
+func TestTimeToBeat(t *testing.T) {
+	timing := newTestTiming()
+	tests := []struct {
+		Time time.Duration
+		Beat float64
+	}{
+		{Time: -500 * time.Millisecond, Beat: -1},
+		{Time: 1000 * time.Millisecond, Beat: 2},
+		{Time: 1500 * time.Millisecond, Beat: 2}, // during the stop
+		{Time: 2250 * time.Millisecond, Beat: 3},
+		{Time: 2750 * time.Millisecond, Beat: 7},
+		{Time: 3200 * time.Millisecond, Beat: 8}, // during the delay
+		{Time: 4000 * time.Millisecond, Beat: 10},
+	}
+	for _, test := range tests {
+		if b := timing.TimeToBeat(test.Time); math.Abs(b-test.Beat) > 1e-9 {
+			t.Log("Time    ", test.Time)
+			t.Log("Beat    ", b)
+			t.Log("Expected", test.Beat)
+			t.Fail()
+		}
+	}
+}
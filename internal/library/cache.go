@@ -0,0 +1,279 @@
+package library
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/parser"
+)
+
+// Cache is an index of the songs in songs directories, kept in a database,
+// so that only the songs whose files changed are parsed again when they
+// are scanned
+type Cache struct {
+	db   *sql.DB
+	hash func(*game.Chart) string // The hash that the chart's scores are keyed by
+}
+
+// NewCache is the index in db, whose tables are made by score.Migrate
+func NewCache(db *sql.DB, hash func(*game.Chart) string) *Cache {
+	return &Cache{db: db, hash: hash}
+}
+
+// stamps are when the song directory, or a directory with one of its files
+// in it, last had files added, removed or renamed, and when the chart files
+// in files last changed
+func stamps(dir string, files []string) (changed, modified int64, err error) {
+	dirs := map[string]bool{dir: true}
+	for _, file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for d := range dirs {
+		info, err := os.Stat(d)
+		if nil != err {
+			return 0, 0, err
+		}
+		if t := info.ModTime().UnixNano(); t > changed {
+			changed = t
+		}
+	}
+	for _, file := range files {
+		if _, ok := parser.ForExtension(strings.ToLower(path.Ext(file))); !ok {
+			continue
+		}
+		info, err := os.Stat(file)
+		if nil != err {
+			return 0, 0, err
+		}
+		if t := info.ModTime().UnixNano(); t > modified {
+			modified = t
+		}
+	}
+	return changed, modified, nil
+}
+
+// signature is what the cached songs are compared by to know that they
+// changed, which is the files in it and their stamps
+func signature(dir string) (list string, changed, modified int64, err error) {
+	audio, charts, _, err := files(dir)
+	if nil != err {
+		return "", 0, 0, err
+	}
+	all := append(charts, audio...)
+	changed, modified, err = stamps(dir, all)
+	return strings.Join(all, "\n"), changed, modified, err
+}
+
+// Scan brings the index of the songs directory root up to date, parsing
+// only the songs that are new or whose files changed, or every song when
+// rescan is set, and returns its packs
+func (c *Cache) Scan(root string, rescan bool) ([]*Pack, error) {
+	root, err := filepath.Abs(root)
+	if nil != err {
+		return nil, err
+	}
+	if rescan {
+		if err := c.remove("where root = ?", root); nil != err {
+			return nil, err
+		}
+	}
+
+	type cached struct {
+		changed  int64
+		files    string
+		modified int64
+	}
+	songs := map[string]cached{}
+	rows, err := c.db.Query("select directory, changed, files, modified from songs where root = ?", root)
+	if nil != err {
+		return nil, err
+	}
+	for rows.Next() {
+		var dir string
+		var song cached
+		if err := rows.Scan(&dir, &song.changed, &song.files, &song.modified); nil != err {
+			rows.Close()
+			return nil, err
+		}
+		songs[dir] = song
+	}
+	rows.Close()
+
+	parsed := 0
+	err = eachSong(root, func(pack, dir string) {
+		// When no files were added or removed, only the files that were
+		// in the song need to be looked at, rather than every file in it
+		song, ok := songs[dir]
+		if ok {
+			changed, modified, err := stamps(dir, strings.Split(song.files, "\n"))
+			if nil == err && changed == song.changed && modified == song.modified {
+				delete(songs, dir)
+				return
+			}
+		}
+		files, changed, modified, err := signature(dir)
+		if nil != err {
+			log.Println("unable to load song", dir, err)
+			return
+		}
+		delete(songs, dir)
+		if ok && song.files == files && song.modified == modified {
+			if _, err := c.db.Exec("update songs set changed = ? where directory = ?", changed, dir); nil != err {
+				log.Println("unable to update song", dir, err)
+			}
+			return
+		}
+		if err := c.update(root, pack, dir, changed, files, modified); nil != err {
+			log.Println("unable to load song", dir, err)
+			return
+		}
+		parsed++
+	})
+	if nil != err {
+		return nil, err
+	}
+	if parsed > 0 {
+		log.Println("parsed", parsed, "new or changed songs")
+	}
+
+	// What is left was removed, or can no longer be loaded
+	for dir := range songs {
+		if err := c.remove("where directory = ?", dir); nil != err {
+			return nil, err
+		}
+	}
+
+	packs, err := c.Packs(root, "")
+	if nil != err {
+		return nil, err
+	}
+	if len(packs) == 0 {
+		return nil, errors.New("no songs found in the songs directory")
+	}
+	return packs, nil
+}
+
+// remove removes the songs, and their charts, that match where
+func (c *Cache) remove(where string, args ...interface{}) error {
+	if _, err := c.db.Exec("delete from charts where directory in (select directory from songs "+where+")", args...); nil != err {
+		return fmt.Errorf("unable to remove songs from the library: %w", err)
+	}
+	if _, err := c.db.Exec("delete from songs "+where, args...); nil != err {
+		return fmt.Errorf("unable to remove songs from the library: %w", err)
+	}
+	return nil
+}
+
+// update parses the song in dir and replaces what is cached of it
+func (c *Cache) update(root, pack, dir string, changed int64, files string, modified int64) error {
+	song, err := Load(dir)
+	if nil != err {
+		return err
+	}
+	audio, err := json.Marshal(song.AudioFiles)
+	if nil != err {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("delete from charts where directory = ?", dir); nil != err {
+		return err
+	}
+	info := song.Info()
+	_, err = tx.Exec(
+		"insert or replace into songs(directory, root, pack, changed, files, modified, title, artist, audio) values(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		dir, root, pack, changed, files, modified, song.Title(), info.Artist, audio,
+	)
+	if nil != err {
+		return err
+	}
+	for i, chart := range song.Charts {
+		metadata, err := json.Marshal(chart.Song)
+		if nil != err {
+			return err
+		}
+		counts, err := json.Marshal(chart.NoteCounts)
+		if nil != err {
+			return err
+		}
+		_, err = tx.Exec(
+			"insert into charts(directory, position, sum, song, type, name, meter, keys, counts, holds, mines) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			dir, i, c.hash(chart), metadata, chart.Difficulty.Type, chart.Difficulty.Name, chart.Difficulty.Msd,
+			chart.Difficulty.NKeys, counts, chart.HoldCount, chart.MineCount,
+		)
+		if nil != err {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Packs are the songs of the songs directory root in the index whose title,
+// artist or pack has query in it. Their charts are only the summaries of
+// the charts, until the song is parsed.
+func (c *Cache) Packs(root, query string) ([]*Pack, error) {
+	root, err := filepath.Abs(root)
+	if nil != err {
+		return nil, err
+	}
+	like := "%" + query + "%"
+	rows, err := c.db.Query(`
+	select s.directory, s.pack, s.audio, c.song, c.type, c.name, c.meter, c.keys, c.counts, c.holds, c.mines
+	  from songs s join charts c on c.directory = s.directory
+	  where s.root = ? and (s.title like ? or s.artist like ? or s.pack like ?)
+	  order by s.pack, s.directory, c.position
+	`, root, like, like, like)
+	if nil != err {
+		return nil, fmt.Errorf("unable to query the library: %w", err)
+	}
+	defer rows.Close()
+
+	packs := []*Pack{}
+	var song *Song
+	for rows.Next() {
+		var dir, pack string
+		var audio, metadata, counts []byte
+		chart := &game.Chart{Song: &game.Song{}}
+		if err := rows.Scan(
+			&dir, &pack, &audio, &metadata, &chart.Difficulty.Type, &chart.Difficulty.Name, &chart.Difficulty.Msd,
+			&chart.Difficulty.NKeys, &counts, &chart.HoldCount, &chart.MineCount,
+		); nil != err {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, chart.Song); nil != err {
+			return nil, err
+		}
+		if err := json.Unmarshal(counts, &chart.NoteCounts); nil != err {
+			return nil, err
+		}
+		for _, count := range chart.NoteCounts {
+			chart.NoteCountsAsStrings = append(chart.NoteCountsAsStrings, strconv.FormatInt(count, 10))
+		}
+
+		if nil == song || song.Directory != dir {
+			song = &Song{Pack: pack, Directory: dir, cached: true}
+			if err := json.Unmarshal(audio, &song.AudioFiles); nil != err {
+				return nil, err
+			}
+			if len(packs) == 0 || packs[len(packs)-1].Name != pack {
+				packs = append(packs, &Pack{Name: pack})
+			}
+			packs[len(packs)-1].Songs = append(packs[len(packs)-1].Songs, song)
+		}
+		song.Charts = append(song.Charts, chart)
+	}
+	return packs, rows.Err()
+}
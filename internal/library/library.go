@@ -0,0 +1,195 @@
+// Package library finds the songs in a song directory, or in a songs
+// directory of packs of song directories
+package library
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/parser"
+)
+
+// Song is a song directory, with its charts and the audio files in it
+type Song struct {
+	Pack       string // The name of the pack it is in, if it is in one
+	Directory  string
+	Charts     []*game.Chart
+	AudioFiles []string
+
+	cached bool // Whether the charts are only the summaries in the cache
+}
+
+// Pack is a directory of songs
+type Pack struct {
+	Name  string
+	Songs []*Song
+}
+
+// Info is the metadata of the song, from its first chart
+func (s *Song) Info() *game.Song {
+	if len(s.Charts) == 0 || nil == s.Charts[0].Song {
+		return &game.Song{}
+	}
+	return s.Charts[0].Song
+}
+
+// Title is the title of the song, or the name of its directory when its
+// charts do not name it
+func (s *Song) Title() string {
+	if title := s.Info().FullTitle(); title != "" {
+		return title
+	}
+	return filepath.Base(s.Directory)
+}
+
+// Audio is the music file that the chart names, or the first audio file in
+// the song directory when it names none that can be found. It is empty for
+// keysounded charts, whose audio files are only samples.
+func (s *Song) Audio(chart *game.Chart) string {
+	if nil != chart.Song && chart.Song.Keysounded {
+		return ""
+	}
+	if nil != chart.Song && chart.Song.Music != "" {
+		if _, err := os.Stat(chart.Song.Music); nil == err {
+			return chart.Song.Music
+		}
+		// Charts made on other systems do not always match the file's case
+		for _, file := range s.AudioFiles {
+			if strings.EqualFold(filepath.Base(file), filepath.Base(chart.Song.Music)) {
+				return file
+			}
+		}
+		log.Println("unable to find music", chart.Song.Music)
+	}
+	return s.AudioFiles[0]
+}
+
+func isAudio(ext string) bool {
+	switch ext {
+	case ".ogg", ".mp3", ".xm", ".mod", ".wav":
+		return true
+	}
+	return false
+}
+
+// IsSong is whether the directory has chart files in it, rather than in
+// directories in it
+func IsSong(dir string) bool {
+	infos, err := ioutil.ReadDir(dir)
+	if nil != err {
+		return false
+	}
+	for _, info := range infos {
+		if _, ok := parser.ForExtension(path.Ext(info.Name())); ok && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// files are the audio files and the chart files in a song directory. Like
+// StepMania, the .ssc files are preferred when both they and .sm files
+// exist, and every file of that type is a chart file, as osu! has one per
+// difficulty.
+func files(dir string) (audio, charts []string, p parser.Parser, err error) {
+	chartFiles := map[string][]string{}
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		ext := strings.ToLower(path.Ext(info.Name()))
+		if isAudio(ext) {
+			audio = append(audio, p)
+		} else if _, ok := parser.ForExtension(ext); ok {
+			chartFiles[ext] = append(chartFiles[ext], p)
+		}
+		return nil
+	}); nil != err {
+		return nil, nil, nil, fmt.Errorf("unable to walk song directory: %w", err)
+	}
+
+	for _, ext := range parser.Extensions {
+		if len(chartFiles[ext]) > 0 {
+			charts = chartFiles[ext]
+			p, _ = parser.ForExtension(ext)
+			break
+		}
+	}
+	if len(audio) == 0 || len(charts) == 0 {
+		return nil, nil, nil, errors.New("unable to find a chart and .mp3/.ogg file in given directory")
+	}
+	return audio, charts, p, nil
+}
+
+// Load parses the charts and finds the audio in the song directory
+func Load(dir string) (*Song, error) {
+	audio, chartFiles, p, err := files(dir)
+	if nil != err {
+		return nil, err
+	}
+	song := &Song{Directory: dir, AudioFiles: audio}
+	for _, file := range chartFiles {
+		charts, err := p.Parse(file)
+		if nil != err {
+			return nil, err
+		}
+		song.Charts = append(song.Charts, charts...)
+	}
+	if len(song.Charts) == 0 {
+		return nil, errors.New("no playable charts found")
+	}
+	return song, nil
+}
+
+// Parse parses the charts of a song from the cache, which only have their
+// summaries and no notes, in place
+func (s *Song) Parse() error {
+	if !s.cached {
+		return nil
+	}
+	song, err := Load(s.Directory)
+	if nil != err {
+		return err
+	}
+	if len(song.Charts) != len(s.Charts) {
+		return errors.New("the song has changed since it was scanned, use --rescan")
+	}
+	for i, chart := range song.Charts {
+		*s.Charts[i] = *chart
+	}
+	s.AudioFiles = song.AudioFiles
+	s.cached = false
+	return nil
+}
+
+// eachSong calls f with each song directory in the songs directory root,
+// and the name of the pack that it is in, one pack after another
+func eachSong(root string, f func(pack, dir string)) error {
+	packDirs, err := ioutil.ReadDir(root)
+	if nil != err {
+		return fmt.Errorf("unable to read songs directory: %w", err)
+	}
+	for _, packDir := range packDirs {
+		if !packDir.IsDir() {
+			continue
+		}
+		songDirs, err := ioutil.ReadDir(filepath.Join(root, packDir.Name()))
+		if nil != err {
+			log.Println("unable to read pack", err)
+			continue
+		}
+		for _, songDir := range songDirs {
+			if songDir.IsDir() {
+				f(packDir.Name(), filepath.Join(root, packDir.Name(), songDir.Name()))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package library
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/score"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const smChart = `#TITLE:Library;
+#OFFSET:0.000;
+#BPMS:0.000=120.000;
+#NOTES:
+     dance-single:
+     :
+     Hard:
+     8:
+     0,0,0,0,0:
+1000
+0100
+0010
+0001
+;
+`
+
+const bmsChart = `#PLAYER 1
+#TITLE Keysounds
+#BPM 120
+#WAV01 kick.wav
+#WAV02 snare.wav
+#00111:0102
+`
+
+func write(t *testing.T, file, content string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); nil != err {
+		t.Fatal(err)
+	}
+}
+
+// newCache is a cache in a new in-memory database, which counts how many
+// charts it parsed
+func newCache(t *testing.T, parsed *int) *Cache {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if nil != err {
+		t.Fatal(err)
+	}
+	// Every connection would be a different database
+	db.SetMaxOpenConns(1)
+	if err := score.Migrate(db); nil != err {
+		t.Fatal(err)
+	}
+	return NewCache(db, func(*game.Chart) string { *parsed++; return "sum" })
+}
+
+func TestScan(t *testing.T) {
+	root, err := ioutil.TempDir("", "library")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	var parsed int
+	cache := newCache(t, &parsed)
+	defer cache.db.Close()
+
+	write(t, filepath.Join(root, "Pack", "Song", "song.sm"), smChart)
+	write(t, filepath.Join(root, "Pack", "Song", "song.ogg"), "")
+	write(t, filepath.Join(root, "Pack", "Silent", "song.sm"), smChart)
+	write(t, filepath.Join(root, "Empty", "Song", "notes.txt"), "")
+
+	if !IsSong(filepath.Join(root, "Pack", "Song")) || IsSong(root) || IsSong(filepath.Join(root, "Pack")) {
+		t.Log("IsSong should only be true for song directories")
+		t.Fail()
+	}
+
+	packs, err := cache.Scan(root, false)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(packs) != 1 || packs[0].Name != "Pack" || len(packs[0].Songs) != 1 {
+		t.Log("Packs", packs)
+		t.FailNow()
+	}
+	song := packs[0].Songs[0]
+	if song.Pack != "Pack" || song.Title() != "Library" || len(song.Charts) != 1 || parsed != 1 {
+		t.Log("Song", song.Pack, song.Title(), len(song.Charts), parsed)
+		t.Fail()
+	}
+	if audio := song.Audio(song.Charts[0]); audio != filepath.Join(root, "Pack", "Song", "song.ogg") {
+		t.Log("Audio", audio)
+		t.Fail()
+	}
+}
+
+func TestAudio(t *testing.T) {
+	root, err := ioutil.TempDir("", "library")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write(t, filepath.Join(root, "Song", "song.sm"), strings.Replace(smChart, "#OFFSET", "#MUSIC:Song.OGG;\n#OFFSET", 1))
+	write(t, filepath.Join(root, "Song", "a.ogg"), "")
+	write(t, filepath.Join(root, "Song", "song.ogg"), "")
+	write(t, filepath.Join(root, "Keysounds", "song.bms"), bmsChart)
+	write(t, filepath.Join(root, "Keysounds", "kick.wav"), "")
+	write(t, filepath.Join(root, "Keysounds", "snare.wav"), "")
+
+	// The keysounds of a BMS chart are not its music
+	for _, test := range []struct {
+		dir      string
+		expected string
+	}{
+		{"Song", filepath.Join(root, "Song", "song.ogg")},
+		{"Keysounds", ""},
+	} {
+		song, err := Load(filepath.Join(root, test.dir))
+		if nil != err {
+			t.Fatal(err)
+		}
+		if audio := song.Audio(song.Charts[0]); audio != test.expected {
+			t.Log("Song    ", test.dir)
+			t.Log("Expected", test.expected)
+			t.Log("Actual  ", audio)
+			t.Fail()
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	songs, err := ioutil.TempDir("", "library")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(songs)
+
+	dir := filepath.Join(songs, "Pack", "Song")
+	chart := filepath.Join(dir, "song.sm")
+	write(t, chart, smChart)
+	write(t, filepath.Join(dir, "song.ogg"), "")
+	other := filepath.Join(songs, "Pack", "Other", "charts", "other.sm")
+	write(t, other, strings.Replace(smChart, "Library", "Other", 1))
+	write(t, filepath.Join(songs, "Pack", "Other", "other.ogg"), "")
+
+	// Only parsed charts are hashed
+	parsed := 0
+	cache := newCache(t, &parsed)
+	defer cache.db.Close()
+	touch := func(file string, hours time.Duration) {
+		later := time.Now().Add(hours * time.Hour)
+		if err := os.Chtimes(file, later, later); nil != err {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		change func()
+		rescan bool
+		parsed int
+	}{
+		{func() {}, false, 2},
+		{func() {}, false, 0},
+		// Charts that are edited in place, even in a directory in the song
+		{func() { touch(chart, 1) }, false, 1},
+		{func() { touch(other, 1) }, false, 1},
+		// Files that are renamed or replaced change the directory, but the
+		// song is the same
+		{func() { touch(dir, 2) }, false, 0},
+		// Other files do not change the song
+		{func() { write(t, filepath.Join(dir, "notes.txt"), "") }, false, 0},
+		{func() {}, true, 2},
+		{func() { os.RemoveAll(filepath.Join(songs, "Pack", "Other")) }, false, 0},
+	} {
+		parsed = 0
+		test.change()
+		if _, err := cache.Scan(songs, test.rescan); nil != err {
+			t.Fatal(err)
+		}
+		if parsed != test.parsed {
+			t.Log("Rescan  ", test.rescan)
+			t.Log("Expected", test.parsed)
+			t.Log("Actual  ", parsed)
+			t.Fail()
+		}
+	}
+
+	packs, err := cache.Packs(songs, "libr")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(packs) != 1 || len(packs[0].Songs) != 1 {
+		t.Log("Packs", packs)
+		t.FailNow()
+	}
+	song := packs[0].Songs[0]
+	if song.Title() != "Library" || len(song.Charts) != 1 || len(song.Charts[0].Notes) != 0 ||
+		strings.Join(song.Charts[0].NoteCountsAsStrings, ",") != "4,0,0,0" {
+		t.Log("Song", song.Title(), len(song.Charts), song.Charts[0].NoteCountsAsStrings)
+		t.Fail()
+	}
+	summary := song.Charts[0]
+	if err := song.Parse(); nil != err {
+		t.Fatal(err)
+	}
+	if song.Charts[0] != summary || len(summary.Notes) != 4 {
+		t.Log("Parsed", song.Charts)
+		t.Fail()
+	}
+
+	if packs, err := cache.Packs(songs, "other"); nil != err || len(packs) != 0 {
+		t.Log("Removed", packs, err)
+		t.Fail()
+	}
+}
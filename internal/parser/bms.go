@@ -0,0 +1,382 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// BMSParser reads the BMS family of charts, .bms, .bme, .bml and .pms, which
+// hold one chart each
+type BMSParser struct{}
+
+// Columns of each chart type, indexed by 1P and 2P note channel
+var (
+	beat5kColumns = map[string]uint8{"16": 0, "11": 1, "12": 2, "13": 3, "14": 4, "15": 5}
+	beat7kColumns = map[string]uint8{"16": 0, "11": 1, "12": 2, "13": 3, "14": 4, "15": 5, "18": 6, "19": 7}
+	popn9kColumns = map[string]uint8{"11": 0, "12": 1, "13": 2, "14": 3, "15": 4, "22": 5, "23": 6, "24": 7, "25": 8}
+)
+
+var bmsDifficulties = map[string]string{
+	"1": "Beginner",
+	"2": "Normal",
+	"3": "Hyper",
+	"4": "Another",
+	"5": "Insane",
+}
+
+// A bmsObject is a non-zero object on a channel of a measure
+type bmsObject struct {
+	beat    float64
+	denom   int
+	channel string
+	id      string
+}
+
+// bmsLines keeps the lines that are in use after #RANDOM blocks, which
+// always take the first branch so that a chart is always the same
+func (p *BMSParser) bmsLines(data string) []string {
+	lines := []string{}
+	skipping := []bool{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.ToUpper(line))
+		switch fields[0] {
+		case "#RANDOM", "#SETRANDOM", "#ENDRANDOM":
+			continue
+		case "#IF":
+			skip := len(fields) < 2 || fields[1] != "1"
+			if len(skipping) > 0 && skipping[len(skipping)-1] {
+				skip = true
+			}
+			skipping = append(skipping, skip)
+			continue
+		case "#ENDIF":
+			if len(skipping) > 0 {
+				skipping = skipping[:len(skipping)-1]
+			}
+			continue
+		}
+		if len(skipping) > 0 && skipping[len(skipping)-1] {
+			continue
+		}
+		lines = append(lines, line[1:])
+	}
+	return lines
+}
+
+// noteChannel is the 1P or 2P note channel of a visible or long note
+// channel, and whether it is a long note channel
+func (p *BMSParser) noteChannel(channel string) (key string, isLN bool, ok bool) {
+	switch channel[0] {
+	case '1', '2':
+		return channel, false, true
+	case '5':
+		return "1" + channel[1:], true, true
+	case '6':
+		return "2" + channel[1:], true, true
+	}
+	return "", false, false
+}
+
+// beatDenom is the snap of a beat within its measure
+func (p *BMSParser) beatDenom(beat float64) int {
+	for _, denom := range snapDenoms {
+		n := beat * float64(denom)
+		if math.Abs(n-math.Round(n)) < 0.001 {
+			return denom
+		}
+	}
+	return -1
+}
+
+func (p *BMSParser) Parse(file string) ([]*game.Chart, error) {
+	data, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	str := strings.ReplaceAll(string(data), "\r", "")
+	headers := map[string]string{}
+	measureLengths := map[int]float64{}
+	channels := map[int]map[string][]string{} // measure => channel => rows
+	lastMeasure := 0
+	section := []string{}
+
+	for _, line := range p.bmsLines(str) {
+		// Channel data is #mmmcc:data
+		if len(line) > 6 && line[5] == ':' {
+			measure, err := strconv.Atoi(line[:3])
+			if nil == err {
+				channel := strings.ToUpper(line[3:5])
+				value := strings.TrimSpace(line[6:])
+				section = append(section, line)
+				if measure > lastMeasure {
+					lastMeasure = measure
+				}
+				if channel == "02" {
+					length, err := strconv.ParseFloat(value, 64)
+					if nil != err {
+						return nil, fmt.Errorf("invalid measure length: %w", err)
+					}
+					measureLengths[measure] = length
+					continue
+				}
+				if _, ok := channels[measure]; !ok {
+					channels[measure] = map[string][]string{}
+				}
+				channels[measure][channel] = append(channels[measure][channel], value)
+				continue
+			}
+		}
+
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) == 2 {
+			headers[strings.ToUpper(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	// Work out the chart type from the channels that are used
+	ext := strings.ToLower(filepath.Ext(file))
+	used := map[string]bool{}
+	for _, chs := range channels {
+		for channel := range chs {
+			if key, _, ok := p.noteChannel(channel); ok {
+				used[key] = true
+			}
+		}
+	}
+	chartType := "beat-5k"
+	columns := beat5kColumns
+	if ext == ".pms" {
+		chartType, columns = "popn-9k", popn9kColumns
+	} else if used["18"] || used["19"] {
+		chartType, columns = "beat-7k", beat7kColumns
+	}
+	for channel := range used {
+		// Double play is not supported
+		if _, ok := columns[channel]; !ok && channel[0] == '2' {
+			return []*game.Chart{}, nil
+		}
+	}
+	nKeys := game.NKeyMap[chartType]
+
+	// Beats start at the sum of the length of every measure before them
+	measureBeats := make([]float64, lastMeasure+2)
+	for m := 0; m <= lastMeasure; m++ {
+		length, ok := measureLengths[m]
+		if !ok {
+			length = 1
+		}
+		measureBeats[m+1] = measureBeats[m] + 4*length
+	}
+
+	objects := []bmsObject{}
+	for m, chs := range channels {
+		length := measureBeats[m+1] - measureBeats[m]
+		for channel, rows := range chs {
+			for _, row := range rows {
+				n := len(row) / 2
+				for i := 0; i < n; i++ {
+					id := strings.ToUpper(row[i*2 : i*2+2])
+					if id == "00" {
+						continue
+					}
+					offset := length * float64(i) / float64(n)
+					objects = append(objects, bmsObject{
+						beat:    measureBeats[m] + offset,
+						denom:   p.beatDenom(offset),
+						channel: channel,
+						id:      id,
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].beat != objects[j].beat {
+			return objects[i].beat < objects[j].beat
+		}
+		return objects[i].channel < objects[j].channel
+	})
+
+	timing := &game.TimingData{}
+	bpm := 130.0
+	if v, ok := headers["BPM"]; ok {
+		if bpm, err = strconv.ParseFloat(v, 64); nil != err {
+			return nil, fmt.Errorf("invalid bpm: %w", err)
+		}
+	}
+	timing.BPMs = append(timing.BPMs, game.BPM{Value: bpm})
+	for _, object := range objects {
+		switch object.channel {
+		case "03":
+			value, err := strconv.ParseInt(object.id, 16, 64)
+			if nil != err {
+				return nil, fmt.Errorf("invalid bpm change: %w", err)
+			}
+			timing.BPMs = append(timing.BPMs, game.BPM{StartingBeat: object.beat, Value: float64(value)})
+		case "08":
+			value, err := strconv.ParseFloat(headers["BPM"+object.id], 64)
+			if nil != err {
+				return nil, fmt.Errorf("invalid bpm %v: %w", object.id, err)
+			}
+			timing.BPMs = append(timing.BPMs, game.BPM{StartingBeat: object.beat, Value: value})
+		}
+	}
+	timing.Init()
+
+	// Stops are in 192nds of a measure, so depend on the tempo at the time
+	for _, object := range objects {
+		if object.channel != "09" {
+			continue
+		}
+		length, err := strconv.ParseFloat(headers["STOP"+object.id], 64)
+		if nil != err {
+			return nil, fmt.Errorf("invalid stop %v: %w", object.id, err)
+		}
+		value := bpm
+		for _, b := range timing.BPMs {
+			if b.StartingBeat > object.beat {
+				break
+			}
+			value = b.Value
+		}
+		timing.Stops = append(timing.Stops, game.Stop{
+			StartingBeat: object.beat,
+			Duration:     length / 48 * 60 / value,
+		})
+	}
+	timing.Init()
+
+	lnObj := strings.ToUpper(headers["LNOBJ"])
+	notes := []*game.Note{}
+	heads := map[uint8]*game.Note{}   // Notes that a #LNOBJ can end
+	openLNs := map[uint8]*game.Note{} // Long notes waiting for their end
+	holdCount := 0
+	for _, object := range objects {
+		key, isLN, ok := p.noteChannel(object.channel)
+		if !ok {
+			continue
+		}
+		column, ok := columns[key]
+		if !ok {
+			continue
+		}
+		t := timing.BeatToTime(object.beat)
+
+		if isLN {
+			// Long note channels pair up a start and an end
+			if head, ok := openLNs[column]; ok {
+				head.TimeEnd = t
+				delete(openLNs, column)
+				continue
+			}
+		} else if object.id == lnObj {
+			if head, ok := heads[column]; ok {
+				head.Kind = game.KindHold
+				head.TimeEnd = t
+				delete(heads, column)
+				holdCount++
+			}
+			continue
+		}
+
+		note := &game.Note{
+			Index:    column,
+			Denom:    object.denom,
+			Time:     t,
+			Keysound: headers["WAV"+object.id],
+		}
+		notes = append(notes, note)
+		if isLN {
+			note.Kind = game.KindHold
+			openLNs[column] = note
+			holdCount++
+		} else {
+			heads[column] = note
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Time < notes[j].Time })
+
+	noteCounts := make([]int64, nKeys)
+	for i := 0; i < len(notes); {
+		j := i
+		for j < len(notes) && notes[j].Time == notes[i].Time {
+			j++
+		}
+		if j-i <= int(nKeys) {
+			noteCounts[j-i-1]++
+		}
+		i = j
+	}
+	noteCountsAsStrings := make([]string, nKeys)
+	for i, count := range noteCounts {
+		noteCountsAsStrings[i] = strconv.FormatInt(count, 10)
+	}
+
+	measures := []*game.Measure{}
+	for m := 0; m <= lastMeasure; m++ {
+		for beat := measureBeats[m]; beat < measureBeats[m+1]-0.001; beat++ {
+			denom := 4
+			if beat == measureBeats[m] {
+				denom = 1
+			}
+			measures = append(measures, &game.Measure{
+				Denom: denom,
+				Time:  timing.BeatToTime(beat),
+			})
+		}
+	}
+
+	name, ok := bmsDifficulties[headers["DIFFICULTY"]]
+	if !ok {
+		name = headers["SUBTITLE"]
+	}
+
+	// There is no music to play, as the song is made of the keysounds
+	dir := filepath.Dir(file)
+	path := func(key string) string {
+		if headers[key] == "" {
+			return ""
+		}
+		return filepath.Join(dir, headers[key])
+	}
+	song := &game.Song{
+		Title:      headers["TITLE"],
+		Subtitle:   headers["SUBTITLE"],
+		Artist:     headers["ARTIST"],
+		Banner:     path("BANNER"),
+		Background: path("BACKBMP"),
+		Keysounded: true,
+	}
+	if song.Background == "" {
+		song.Background = path("STAGEFILE")
+	}
+
+	return []*game.Chart{{
+		Notes:               notes,
+		Measures:            measures,
+		NoteCounts:          noteCounts,
+		NoteCountsAsStrings: noteCountsAsStrings,
+		HoldCount:           int64(holdCount),
+		Difficulty: game.Difficulty{
+			Type:    chartType,
+			Name:    name,
+			Msd:     headers["PLAYLEVEL"],
+			Section: strings.Join(section, "\n"),
+			NKeys:   nKeys,
+		},
+		Timing: timing,
+		Song:   song,
+	}}, nil
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+const bmsChart = `*---------------------- HEADER FIELD
+#PLAYER 1
+#TITLE Channels
+#PLAYLEVEL 7
+#DIFFICULTY 3
+#BPM 120
+#BPM01 240
+#STOP01 96
+#LNOBJ ZZ
+#WAV0A kick.wav
+
+*---------------------- MAIN DATA FIELD
+#00002:0.5
+#00016:0A00
+#00111:0A000000
+#00109:00000001
+#00111:000000ZZ
+#00108:0001
+#00251:01000100
+#00218:0000000A
+#RANDOM 2
+#IF 2
+#00311:0A
+#ENDIF
+`
+
+func TestParseBMS(t *testing.T) {
+	parser := BMSParser{}
+	charts, err := parser.Parse(writeChart(t, "chart.bme", bmsChart))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 {
+		t.Fatal("expected 1 chart, got", len(charts))
+	}
+	chart := charts[0]
+	d := chart.Difficulty
+	if d.Type != "beat-7k" || d.NKeys != 8 || d.Name != "Hyper" || d.Msd != "7" {
+		t.Log("Difficulty", d.Type, d.NKeys, d.Name, d.Msd)
+		t.Fail()
+	}
+
+	// Measure 0 is 2 beats long, the tempo doubles on beat 4, and there is a
+	// stop of 2 beats after beat 5
+	expected := []struct {
+		Index    uint8
+		Time     time.Duration
+		TimeEnd  time.Duration
+		Keysound string
+	}{
+		{Index: 0, Time: 0, Keysound: "kick.wav"},
+		{Index: 1, Time: 1000 * time.Millisecond, TimeEnd: 2250 * time.Millisecond, Keysound: "kick.wav"},
+		{Index: 1, Time: 3000 * time.Millisecond, TimeEnd: 3500 * time.Millisecond},
+		{Index: 6, Time: 3750 * time.Millisecond, Keysound: "kick.wav"},
+	}
+	if len(chart.Notes) != len(expected) {
+		for _, n := range chart.Notes {
+			t.Log(*n)
+		}
+		t.Fatal("expected", len(expected), "notes, got", len(chart.Notes))
+	}
+	for i, note := range chart.Notes {
+		e := expected[i]
+		if note.Index != e.Index || note.Time != e.Time || note.TimeEnd != e.TimeEnd || note.Keysound != e.Keysound {
+			t.Log("Note    ", *note)
+			t.Log("Expected", e)
+			t.Fail()
+		}
+	}
+	if chart.HoldCount != 2 {
+		t.Log("Holds", chart.HoldCount)
+		t.Fail()
+	}
+}
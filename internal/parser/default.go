@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"fmt"
 	"io/ioutil"
 	"math/big"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -12,19 +14,148 @@ import (
 
 type DefaultParser struct{}
 
-func (p *DefaultParser) getSecondsPerNote(rates []game.BPM, currentBeat float64, bpn float64) (float64, float64) {
-	sel := float64(0.0)
-	for _, bpm := range rates {
-		if currentBeat >= bpm.StartingBeat {
-			sel = bpm.Value
-			// log.Println("set bpm to", bpm)
+// parseBeatList parses a list of beat=value entries such as #BPMS or #STOPS,
+// where each entry has at least n values
+func (p *DefaultParser) parseBeatList(value string, n int) ([][]float64, error) {
+	value = strings.ReplaceAll(value, "\n", "")
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), ";"))
+	entries := [][]float64{}
+	if value == "" {
+		return entries, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		as := strings.Split(entry, "=")
+		if len(as) < n {
+			return nil, fmt.Errorf("invalid beat entry: %v", entry)
+		}
+		values := make([]float64, len(as))
+		for i, a := range as {
+			v, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+			if nil != err {
+				return nil, err
+			}
+			values[i] = v
+		}
+		entries = append(entries, values)
+	}
+	return entries, nil
+}
+
+// parseTimingTag sets the timing field for a #KEY:VALUE; tag, and returns
+// false if the tag is not a timing tag
+func (p *DefaultParser) parseTimingTag(timing *game.TimingData, key, value string) (bool, error) {
+	switch key {
+	case "OFFSET":
+		offs, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, ";")), 64)
+		if nil != err {
+			return true, err
+		}
+		timing.Offset = -offs
+		return true, nil
+	case "BPMS", "STOPS", "DELAYS", "WARPS", "SCROLLS", "FAKES":
+		entries, err := p.parseBeatList(value, 2)
+		if nil != err {
+			return true, err
+		}
+		switch key {
+		case "BPMS":
+			timing.BPMs = []game.BPM{}
+		case "STOPS":
+			timing.Stops = []game.Stop{}
+		case "DELAYS":
+			timing.Delays = []game.Delay{}
+		case "WARPS":
+			timing.Warps = []game.Warp{}
+		case "SCROLLS":
+			timing.Scrolls = []game.Scroll{}
+		case "FAKES":
+			timing.Fakes = []game.Fake{}
+		}
+		for _, e := range entries {
+			switch key {
+			case "BPMS":
+				timing.BPMs = append(timing.BPMs, game.BPM{StartingBeat: e[0], Value: e[1]})
+			case "STOPS":
+				timing.Stops = append(timing.Stops, game.Stop{StartingBeat: e[0], Duration: e[1]})
+			case "DELAYS":
+				timing.Delays = append(timing.Delays, game.Delay{StartingBeat: e[0], Duration: e[1]})
+			case "WARPS":
+				timing.Warps = append(timing.Warps, game.Warp{StartingBeat: e[0], Length: e[1]})
+			case "SCROLLS":
+				timing.Scrolls = append(timing.Scrolls, game.Scroll{StartingBeat: e[0], Ratio: e[1]})
+			case "FAKES":
+				timing.Fakes = append(timing.Fakes, game.Fake{StartingBeat: e[0], Length: e[1]})
+			}
+		}
+		return true, nil
+	case "SPEEDS":
+		entries, err := p.parseBeatList(value, 3)
+		if nil != err {
+			return true, err
+		}
+		timing.Speeds = []game.Speed{}
+		for _, e := range entries {
+			timing.Speeds = append(timing.Speeds, game.Speed{
+				StartingBeat: e[0],
+				Ratio:        e[1],
+				Duration:     e[2],
+				InSeconds:    len(e) > 3 && e[3] == 1,
+			})
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseSongTag sets the song field for a #KEY:VALUE; tag, with file paths
+// relative to dir, and returns false if the tag is not song metadata
+func (p *DefaultParser) parseSongTag(song *game.Song, dir, key, value string) (bool, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), ";"))
+	path := func() string {
+		if value == "" {
+			return ""
+		}
+		return filepath.Join(dir, value)
+	}
+	switch key {
+	case "TITLE":
+		song.Title = value
+	case "SUBTITLE":
+		song.Subtitle = value
+	case "ARTIST":
+		song.Artist = value
+	case "TITLETRANSLIT":
+		song.TitleTranslit = value
+	case "SUBTITLETRANSLIT":
+		song.SubtitleTranslit = value
+	case "ARTISTTRANSLIT":
+		song.ArtistTranslit = value
+	case "CREDIT":
+		song.Credit = value
+	case "MUSIC":
+		song.Music = path()
+	case "BANNER":
+		song.Banner = path()
+	case "BACKGROUND":
+		song.Background = path()
+	case "SAMPLESTART", "SAMPLELENGTH":
+		if value == "" {
+			return true, nil
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if nil != err {
+			return true, fmt.Errorf("invalid %v: %w", strings.ToLower(key), err)
+		}
+		d := time.Duration(seconds * float64(time.Second))
+		if key == "SAMPLESTART" {
+			song.SampleStart = d
 		} else {
-			break
+			song.SampleLength = d
 		}
+	default:
+		return false, nil
 	}
-	secondsPerBeat := 60.0 / sel
-	// log.Println("secondsPerBeat", secondsPerBeat)
-	return sel, bpn * secondsPerBeat
+	return true, nil
 }
 
 // 0 – No note
@@ -37,9 +168,24 @@ func (p *DefaultParser) getSecondsPerNote(rates []game.BPM, currentBeat float64,
 // L – Lift note
 // F – Fake note
 
-func (p *DefaultParser) mapToNote(ch byte) bool {
-	t := string(ch)
-	return t == "1" || t == "2" || t == "4" || t == "M"
+func (p *DefaultParser) mapToNote(ch byte) (game.NoteKind, bool) {
+	switch ch {
+	case '1':
+		return game.KindTap, true
+	case '2':
+		return game.KindHold, true
+	case '4':
+		return game.KindRoll, true
+	case 'M':
+		return game.KindMine, true
+	case 'L':
+		return game.KindLift, true
+	case 'F':
+		return game.KindFake, true
+	case 'K':
+		return game.KindKeysound, true
+	}
+	return game.KindTap, false
 }
 
 func (p *DefaultParser) Parse(file string) ([]*game.Chart, error) {
@@ -61,6 +207,7 @@ func (p *DefaultParser) Parse(file string) ([]*game.Chart, error) {
 			continue
 		}
 		difficulties = append(difficulties, game.Difficulty{
+			Type:    chartType,
 			Name:    strings.TrimSuffix(strings.TrimSpace(lines[3]), ":"),
 			Msd:     strings.TrimSuffix(strings.TrimSpace(lines[4]), ":"),
 			Section: lines[6],
@@ -68,162 +215,157 @@ func (p *DefaultParser) Parse(file string) ([]*game.Chart, error) {
 		})
 	}
 
-	offset := 0.0
-	bpms := []game.BPM{}
-
+	timing := &game.TimingData{}
+	song := &game.Song{}
 	for _, mdl := range strings.Split(meta, "\n#") {
-		mdl = strings.TrimSpace(mdl)
-		if strings.HasPrefix(mdl, "OFFSET:") {
-			mdl = strings.TrimPrefix(mdl, "OFFSET:")
-			mdl = strings.TrimSuffix(mdl, ";")
-			offs, err := strconv.ParseFloat(mdl, 64)
-			if nil != err {
-				return nil, err
-			}
-			offset = -offs
-		} else if strings.HasPrefix(mdl, "BPMS:") {
-			mdl = strings.TrimPrefix(mdl, "BPMS:")
-			mdl = strings.ReplaceAll(mdl, "\n", "")
-			bbs := strings.Split(strings.TrimSuffix(mdl, ";"), ",")
-			for _, bpm := range bbs {
-				as := strings.Split(bpm, "=")
-				sb, err := strconv.ParseFloat(as[0], 64)
-				if nil != err {
-					return nil, err
-				}
-				bbbs, err := strconv.ParseFloat(as[1], 64)
-				if nil != err {
-					return nil, err
-				}
-				bpms = append(bpms, game.BPM{
-					StartingBeat: sb,
-					Value:        bbbs,
-				})
-			}
+		mdl = strings.TrimPrefix(strings.TrimSpace(mdl), "#")
+		kv := strings.SplitN(mdl, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		isSong, err := p.parseSongTag(song, filepath.Dir(file), kv[0], kv[1])
+		if nil != err {
+			return nil, err
+		} else if isSong {
+			continue
+		}
+		if _, err := p.parseTimingTag(timing, kv[0], kv[1]); nil != err {
+			return nil, err
 		}
 	}
+	timing.Init()
 
 	charts := []*game.Chart{}
 	for _, difficulty := range difficulties {
-		// Start time of first note
-		seconds := offset
-		var currentBeat float64 = 0.0
-
-		notes := []*game.Note{}
-		mineCount := 0
-		holdCount := 0
-		noteCounts := make([]int64, difficulty.NKeys)
-
-		blocks := strings.Split(difficulty.Section, "\n,")
-		measureTimes := []*game.Measure{}
-
-		for _, block := range blocks {
-			measureTimes = append(measureTimes, &game.Measure{
-				Denom: 1,
-				Time:  time.Duration(seconds * 1000 * 1000 * 1000),
-			})
+		chart := p.parseChart(difficulty, timing)
+		chart.Song = song
+		charts = append(charts, chart)
+	}
 
-			lines := []string{}
-			bls := strings.Split(block, "\n")
-			for _, l := range bls {
-				if strings.HasPrefix(l, " ") || strings.Contains(l, "-") {
-					continue
-				}
-				l = strings.TrimSpace(l)
-				if len(l) > 3 {
-					lines = append(lines, l)
-				}
+	return charts, nil
+}
+
+// parseChart reads the note rows of a difficulty, timed by timing
+func (p *DefaultParser) parseChart(difficulty game.Difficulty, timing *game.TimingData) *game.Chart {
+	notes := []*game.Note{}
+	mineCount := 0
+	holdCount := 0
+	noteCounts := make([]int64, difficulty.NKeys)
+
+	blocks := strings.Split(difficulty.Section, "\n,")
+	measureTimes := []*game.Measure{}
+	heads := map[int]*game.Note{} // Hold and roll heads waiting for a tail
+
+	for m, block := range blocks {
+		measureTimes = append(measureTimes, &game.Measure{
+			Denom: 1,
+			Time:  timing.BeatToTime(float64(m * 4)),
+		})
+
+		lines := []string{}
+		bls := strings.Split(block, "\n")
+		for _, l := range bls {
+			if strings.HasPrefix(l, " ") || strings.Contains(l, "-") {
+				continue
+			}
+			l = strings.TrimSpace(l)
+			if len(l) > 3 {
+				lines = append(lines, l)
 			}
+		}
 
-			// Beat count is 4 per block
-			lineCount := int64(len(lines))
-			beatsPerNote := 4.0 / float64(lineCount) // 1/4, 1/8, 1/16, 1/24 etc
-
-			// for each note line in a block
-			for i, line := range lines {
-				chs := []byte(line)
-				r := big.NewRat(int64(i*4), lineCount)
-				denom := r.Denom().Int64()
-				if denom == 1 && i != 0 {
-					measureTimes = append(measureTimes, &game.Measure{
-						Denom: 4,
-						Time:  time.Duration(seconds * 1000 * 1000 * 1000),
-					})
-				}
-				if denom == 2 || denom == 4 {
-					measureTimes = append(measureTimes, &game.Measure{
-						Denom: 8,
-						Time:  time.Duration(seconds * 1000 * 1000 * 1000),
-					})
+		// Beat count is 4 per block
+		lineCount := int64(len(lines))
+
+		// for each note line in a block
+		for i, line := range lines {
+			chs := []byte(line)
+
+			r := big.NewRat(int64(i*4), lineCount)
+			denom := r.Denom().Int64()
+
+			// Work out the beat of each row from the measure, rather
+			// than summing row lengths, so that error does not build up
+			beat := float64(m*4) + float64(i*4)/float64(lineCount)
+			rowTime := timing.BeatToTime(beat)
+			if denom == 1 && i != 0 {
+				measureTimes = append(measureTimes, &game.Measure{
+					Denom: 4,
+					Time:  rowTime,
+				})
+			}
+			if denom == 2 || denom == 4 {
+				measureTimes = append(measureTimes, &game.Measure{
+					Denom: 8,
+					Time:  rowTime,
+				})
+			}
+
+			createNote := func(index uint8, kind game.NoteKind) *game.Note {
+				// log.Printf("(%v) %v/%v = %v%vth\033[0m", bpm, i, lineCount, (denom), denom)
+				if kind == game.KindMine {
+					mineCount++
+				} else if kind == game.KindHold || kind == game.KindRoll {
+					holdCount++
 				}
-				_, secondsPerNote := p.getSecondsPerNote(bpms, currentBeat, beatsPerNote)
-
-				createNote := func(index uint8, c byte) *game.Note {
-					// log.Printf("(%v) %v/%v = %v%vth\033[0m", bpm, i, lineCount, (denom), denom)
-					if c == 'M' {
-						mineCount++
-					} else if c == '2' || c == '4' {
-						holdCount++
-					}
-					return &game.Note{
-						Index:  index,
-						Denom:  int(denom),
-						IsMine: c == 'M',
-						Time:   time.Duration(seconds * 1000 * 1000 * 1000),
-					}
+				return &game.Note{
+					Index: index,
+					Denom: int(denom),
+					Kind:  kind,
+					Time:  rowTime,
 				}
+			}
 
-				hitCount := 0
-				for i, c := range chs {
-					// Positive hits at the same time
-					if c == '1' || c == '2' || c == '4' {
-						hitCount++
-					}
+			// Notes in fake and warped sections are drawn but never hit, and
+			// tails in them still end a hold that started before them
+			fake := timing.IsFake(beat)
 
-					if p.mapToNote(c) {
-						notes = append(notes, createNote(uint8(i), c))
-					} else if c == '3' {
-						// This is a release note of a previous head
-						// Find the last note of type head in this column and
-						// add this as the endtime to it
-						// Loop through notes in reverse
-						for j := len(notes) - 1; j >= 0; j-- {
-							note := notes[j]
-							if int(note.Index) != i {
-								continue
-							}
-
-							// This will be the matching note
-							note.TimeEnd = time.Duration(seconds * 1000 * 1000 * 1000)
-							break
-						}
-					}
+			hitCount := 0
+			for i, c := range chs {
+				kind, ok := p.mapToNote(c)
+				if ok && fake && kind != game.KindKeysound {
+					kind = game.KindFake
 				}
 
-				if hitCount > 0 {
-					noteCounts[hitCount-1] += 1
+				// Positive hits at the same time
+				if ok && (kind == game.KindTap || kind == game.KindHold || kind == game.KindRoll || kind == game.KindLift) {
+					hitCount++
 				}
 
-				seconds += secondsPerNote
-				currentBeat += beatsPerNote
+				if ok {
+					note := createNote(uint8(i), kind)
+					notes = append(notes, note)
+					if kind == game.KindHold || kind == game.KindRoll {
+						heads[i] = note
+					}
+				} else if c == '3' {
+					// This is a release note of the last head in this column
+					if head, ok := heads[i]; ok {
+						head.TimeEnd = rowTime
+						delete(heads, i)
+					}
+				}
 			}
-		}
 
-		noteCountsAsStrings := make([]string, difficulty.NKeys)
-		for i, count := range noteCounts {
-			noteCountsAsStrings[i] = strconv.FormatInt(count, 10)
+			if hitCount > 0 {
+				noteCounts[hitCount-1] += 1
+			}
 		}
+	}
 
-		charts = append(charts, &game.Chart{
-			Notes:               notes,
-			Measures:            measureTimes,
-			NoteCounts:          noteCounts,
-			NoteCountsAsStrings: noteCountsAsStrings,
-			HoldCount:           int64(holdCount),
-			MineCount:           int64(mineCount),
-			Difficulty:          difficulty,
-		})
+	noteCountsAsStrings := make([]string, difficulty.NKeys)
+	for i, count := range noteCounts {
+		noteCountsAsStrings[i] = strconv.FormatInt(count, 10)
 	}
 
-	return charts, nil
+	return &game.Chart{
+		Notes:               notes,
+		Measures:            measureTimes,
+		NoteCounts:          noteCounts,
+		NoteCountsAsStrings: noteCountsAsStrings,
+		HoldCount:           int64(holdCount),
+		MineCount:           int64(mineCount),
+		Difficulty:          difficulty,
+		Timing:              timing,
+	}
 }
@@ -0,0 +1,245 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pausedChart = `#TITLE:Paused;
+#OFFSET:0.000;
+#BPMS:0.000=120.000;
+#STOPS:1.000=1.000;
+#DELAYS:2.000=0.500;
+#NOTES:
+     dance-single:
+     :
+     Beginner:
+     1:
+     0,0,0,0,0:
+1000
+0100
+0010
+0001
+,
+1000
+0000
+0000
+0000
+;
+`
+
+func writeChart(t *testing.T, name, data string) string {
+	dir, err := ioutil.TempDir("", "eotw")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(data), 0644); nil != err {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseStopsAndDelays(t *testing.T) {
+	parser := DefaultParser{}
+	charts, err := parser.Parse(writeChart(t, "paused.sm", pausedChart))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 {
+		t.Fatal("expected 1 chart, got", len(charts))
+	}
+
+	expected := []time.Duration{
+		0,                       // beat 0
+		500 * time.Millisecond,  // beat 1, hit before the stop
+		2500 * time.Millisecond, // beat 2, after the stop and the delay
+		3000 * time.Millisecond, // beat 3
+		3500 * time.Millisecond, // beat 4
+	}
+	notes := charts[0].Notes
+	if len(notes) != len(expected) {
+		t.Fatal("expected", len(expected), "notes, got", len(notes))
+	}
+	for i, note := range notes {
+		if note.Time != expected[i] {
+			t.Log("Note    ", i, note.Time)
+			t.Log("Expected", expected[i])
+			t.Fail()
+		}
+	}
+
+	// The second measure line starts on beat 4
+	found := false
+	for _, measure := range charts[0].Measures {
+		if measure.Denom == 1 && measure.Time == 3500*time.Millisecond {
+			found = true
+		}
+	}
+	if !found {
+		t.Log("Measures", charts[0].Measures)
+		t.Log("Expected a measure at", 3500*time.Millisecond)
+		t.Fail()
+	}
+}
+
+func TestParseNoDrift(t *testing.T) {
+	type change struct {
+		beat  *big.Rat
+		value string
+	}
+
+	// Around 10 minutes of 16ths, changing tempo every measure and again
+	// an irregular distance into each measure
+	measures := 440
+	changes := []change{}
+	var bpms, section strings.Builder
+	for m := 0; m < measures; m++ {
+		first := fmt.Sprintf("%v.%03d", 120+(m*37)%100, (m*7919)%1000)
+		second := fmt.Sprintf("%v.%03d", 130+(m*53)%90, (m*104729)%1000)
+		changes = append(changes,
+			change{big.NewRat(int64(m*4), 1), first},
+			change{big.NewRat(int64(m*12+5), 3), second},
+		)
+		if m > 0 {
+			bpms.WriteString(",\n")
+		}
+		fmt.Fprintf(&bpms, "%v=%v,\n%v=%v", m*4, first, float64(m*12+5)/3, second)
+
+		if m > 0 {
+			section.WriteString(",\n")
+		}
+		for r := 0; r < 16; r++ {
+			section.WriteString("1000\n")
+		}
+	}
+
+	data := fmt.Sprintf(`#OFFSET:-0.123;
+#BPMS:%v;
+#NOTES:
+     dance-single:
+     :
+     Challenge:
+     12:
+     0,0,0,0,0:
+%v;
+`, bpms.String(), section.String())
+
+	parser := DefaultParser{}
+	charts, err := parser.Parse(writeChart(t, "drift.sm", data))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// The beats of the changes were written as floats, so use the same
+	// rounded beats for the exact calculation
+	starts := make([]*big.Rat, len(changes))
+	for i := range changes {
+		beat, _ := changes[i].beat.Float64()
+		changes[i].beat = new(big.Rat).SetFloat64(beat)
+	}
+	spb := make([]*big.Rat, len(changes))
+	for i := range changes {
+		bpm, _ := new(big.Rat).SetString(changes[i].value)
+		spb[i] = new(big.Rat).Quo(big.NewRat(60, 1), bpm)
+	}
+	starts[0], _ = new(big.Rat).SetString("0.123")
+	for i := 1; i < len(changes); i++ {
+		length := new(big.Rat).Sub(changes[i].beat, changes[i-1].beat)
+		starts[i] = new(big.Rat).Add(starts[i-1], length.Mul(length, spb[i-1]))
+	}
+
+	notes := charts[0].Notes
+	if len(notes) != measures*16 {
+		t.Fatal("expected", measures*16, "notes, got", len(notes))
+	}
+	c := 0
+	for n, note := range notes {
+		beat := big.NewRat(int64(n), 4)
+		for c+1 < len(changes) && changes[c+1].beat.Cmp(beat) <= 0 {
+			c++
+		}
+		exact := new(big.Rat).Sub(beat, changes[c].beat)
+		exact.Mul(exact, spb[c])
+		exact.Add(exact, starts[c])
+		exact.Mul(exact, big.NewRat(int64(time.Second), 1))
+		ns, _ := exact.Float64()
+
+		diff := note.Time - time.Duration(ns)
+		if diff > time.Microsecond || diff < -time.Microsecond {
+			t.Log("Note    ", n, note.Time)
+			t.Log("Expected", time.Duration(ns))
+			t.FailNow()
+		}
+	}
+	if last := notes[len(notes)-1].Time; last < 9*time.Minute {
+		t.Log("Chart only lasts", last)
+		t.Fail()
+	}
+}
+
+const songChart = `#TITLE:曲;
+#SUBTITLE:(Extended);
+#ARTIST:Artist;
+#TITLETRANSLIT:Kyoku;
+#CREDIT:Stepper;
+#MUSIC:Song.ogg;
+#BANNER:bn.png;
+#BACKGROUND:;
+#SAMPLESTART:12.5;
+#SAMPLELENGTH:10;
+#OFFSET:0.000;
+#BPMS:0.000=120.000;
+#NOTES:
+     dance-single:
+     :
+     Beginner:
+     1:
+     0,0,0,0,0:
+1000
+0000
+0000
+0000
+;
+`
+
+func TestParseSong(t *testing.T) {
+	parser := DefaultParser{}
+	file := writeChart(t, "song.sm", songChart)
+	charts, err := parser.Parse(file)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 || nil == charts[0].Song {
+		t.Fatal("expected 1 chart with a song")
+	}
+
+	dir := filepath.Dir(file)
+	song := charts[0].Song
+	expected := map[string][2]string{
+		"title":      {song.FullTitle(), "曲 (Extended)"},
+		"artist":     {song.Artist, "Artist"},
+		"translit":   {song.TitleTranslit, "Kyoku"},
+		"credit":     {song.Credit, "Stepper"},
+		"music":      {song.Music, filepath.Join(dir, "Song.ogg")},
+		"banner":     {song.Banner, filepath.Join(dir, "bn.png")},
+		"background": {song.Background, ""},
+		"start":      {song.SampleStart.String(), "12.5s"},
+		"length":     {song.SampleLength.String(), "10s"},
+	}
+	for name, values := range expected {
+		if values[0] != values[1] {
+			t.Log("Field   ", name)
+			t.Log("Value   ", values[0])
+			t.Log("Expected", values[1])
+			t.Fail()
+		}
+	}
+}
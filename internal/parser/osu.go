@@ -0,0 +1,368 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// OsuParser reads osu!mania .osu beatmaps, each of which holds one chart
+type OsuParser struct{}
+
+type timingPoint struct {
+	time        float64 // ms
+	beatLength  float64 // ms per beat
+	meter       int
+	uninherited bool
+
+	// Whether this point changes the scroll velocity to velocity
+	changesVelocity bool
+	velocity        float64
+}
+
+// Beat snaps that notes are coloured by, in the order they are checked
+var snapDenoms = []int{1, 2, 3, 4, 6, 8, 12, 16, 24, 32, 48, 64}
+
+// parseSections splits a beatmap into the lines of each [Section]
+func (p *OsuParser) parseSections(data string) map[string][]string {
+	sections := map[string][]string{}
+	current := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.Trim(line, "[]")
+			continue
+		}
+		sections[current] = append(sections[current], line)
+	}
+	return sections
+}
+
+// parseValues reads the Key: Value lines of a section
+func (p *OsuParser) parseValues(lines []string) map[string]string {
+	values := map[string]string{}
+	for _, line := range lines {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return values
+}
+
+// parseSong reads the song metadata, with file paths relative to dir
+func (p *OsuParser) parseSong(dir string, general, metadata map[string]string, events []string) *game.Song {
+	song := &game.Song{
+		Title:  metadata["Title"],
+		Artist: metadata["Artist"],
+		Credit: metadata["Creator"],
+	}
+	// The unicode names are the originals of the romanised ones
+	if title := metadata["TitleUnicode"]; title != "" && title != song.Title {
+		song.Title, song.TitleTranslit = title, song.Title
+	}
+	if artist := metadata["ArtistUnicode"]; artist != "" && artist != song.Artist {
+		song.Artist, song.ArtistTranslit = artist, song.Artist
+	}
+	if audio := general["AudioFilename"]; audio != "" {
+		song.Music = filepath.Join(dir, audio)
+	}
+	if preview, err := strconv.ParseFloat(general["PreviewTime"], 64); nil == err && preview >= 0 {
+		song.SampleStart = time.Duration(preview * float64(time.Millisecond))
+	}
+	// The background is the event 0,0,"file",x,y
+	for _, event := range events {
+		fields := strings.Split(event, ",")
+		if len(fields) >= 3 && fields[0] == "0" {
+			song.Background = filepath.Join(dir, strings.Trim(fields[2], `"`))
+			break
+		}
+	}
+	return song
+}
+
+func (p *OsuParser) parseTimingPoints(lines []string) ([]timingPoint, error) {
+	points := []timingPoint{}
+	for _, line := range lines {
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid timing point: %v", line)
+		}
+		t, err := strconv.ParseFloat(fields[0], 64)
+		if nil != err {
+			return nil, err
+		}
+		beatLength, err := strconv.ParseFloat(fields[1], 64)
+		if nil != err {
+			return nil, err
+		}
+		point := timingPoint{
+			time:            t,
+			beatLength:      beatLength,
+			meter:           4,
+			uninherited:     beatLength > 0,
+			changesVelocity: true,
+			velocity:        1,
+		}
+		if len(fields) > 2 {
+			if meter, err := strconv.Atoi(fields[2]); nil == err && meter > 0 {
+				point.meter = meter
+			}
+		}
+		if len(fields) > 6 {
+			point.uninherited = fields[6] == "1"
+		}
+		// Inherited points set the velocity as a negative inverse percentage
+		if !point.uninherited {
+			point.velocity = -100 / beatLength
+		}
+		points = append(points, point)
+	}
+	return p.sortTimingPoints(points), nil
+}
+
+func (p *OsuParser) sortTimingPoints(points []timingPoint) []timingPoint {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].time < points[j].time })
+	return points
+}
+
+// buildTiming converts the timing points into beat based timing, where
+// velocity changes become scroll changes
+func (p *OsuParser) buildTiming(points []timingPoint) *game.TimingData {
+	timing := &game.TimingData{}
+	lastBeat := 0.0
+	var last *timingPoint
+	for i := range points {
+		point := &points[i]
+		beat := lastBeat
+		if nil != last {
+			beat += (point.time - last.time) / last.beatLength
+		}
+		if point.uninherited {
+			if nil == last {
+				timing.Offset = point.time / 1000
+			}
+			timing.BPMs = append(timing.BPMs, game.BPM{
+				StartingBeat: beat,
+				Value:        60000 / point.beatLength,
+			})
+			last, lastBeat = point, beat
+		}
+		if point.changesVelocity {
+			timing.Scrolls = append(timing.Scrolls, game.Scroll{
+				StartingBeat: beat,
+				Ratio:        point.velocity,
+			})
+		}
+	}
+
+	// Without any scroll velocity changes there is nothing to scale
+	constant := true
+	for _, scroll := range timing.Scrolls {
+		if scroll.Ratio != 1 {
+			constant = false
+		}
+	}
+	if constant {
+		timing.Scrolls = nil
+	}
+	timing.Init()
+	return timing
+}
+
+// snap is the beat denominator that a time in ms falls on
+func (p *OsuParser) snap(points []timingPoint, t float64) int {
+	var point *timingPoint
+	for i := range points {
+		if points[i].time > t+1 {
+			break
+		}
+		if points[i].uninherited {
+			point = &points[i]
+		}
+	}
+	if nil == point {
+		return 1
+	}
+	beat := (t - point.time) / point.beatLength
+	for _, denom := range snapDenoms {
+		n := beat * float64(denom)
+		// Times are rounded to whole ms, so allow for that much error
+		if math.Abs(n-math.Round(n))*point.beatLength/float64(denom) < 2 {
+			return denom
+		}
+	}
+	return -1
+}
+
+// buildMeasures places a line on each beat of every uninherited section
+func (p *OsuParser) buildMeasures(points []timingPoint, end float64) []*game.Measure {
+	uninherited := []timingPoint{}
+	for _, point := range points {
+		if point.uninherited {
+			uninherited = append(uninherited, point)
+		}
+	}
+	measures := []*game.Measure{}
+	for i, point := range uninherited {
+		until := end
+		if i+1 < len(uninherited) {
+			until = uninherited[i+1].time
+		}
+		for b := 0; ; b++ {
+			t := point.time + float64(b)*point.beatLength
+			if t >= until-1 {
+				break
+			}
+			denom := 4
+			if b%point.meter == 0 {
+				denom = 1
+			}
+			measures = append(measures, &game.Measure{
+				Denom: denom,
+				Time:  time.Duration(t * float64(time.Millisecond)),
+			})
+		}
+	}
+	return measures
+}
+
+func (p *OsuParser) Parse(file string) ([]*game.Chart, error) {
+	data, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	str := strings.ReplaceAll(string(data), "\r", "")
+	sections := p.parseSections(str)
+	general := p.parseValues(sections["General"])
+	metadata := p.parseValues(sections["Metadata"])
+	difficulty := p.parseValues(sections["Difficulty"])
+
+	// Only mania beatmaps can be played
+	if general["Mode"] != "3" {
+		return []*game.Chart{}, nil
+	}
+
+	circleSize, err := strconv.ParseFloat(difficulty["CircleSize"], 64)
+	if nil != err {
+		return nil, fmt.Errorf("invalid key count: %w", err)
+	}
+	nKeys, ok := game.NKeyMap[game.ManiaKeyMode(uint8(circleSize))]
+	if !ok {
+		return []*game.Chart{}, nil
+	}
+
+	points, err := p.parseTimingPoints(sections["TimingPoints"])
+	if nil != err {
+		return nil, err
+	}
+
+	notes := []*game.Note{}
+	for _, line := range sections["HitObjects"] {
+		fields := strings.Split(line, ",")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid hit object: %v", line)
+		}
+		x, err := strconv.ParseFloat(fields[0], 64)
+		if nil != err {
+			return nil, err
+		}
+		t, err := strconv.ParseFloat(fields[2], 64)
+		if nil != err {
+			return nil, err
+		}
+		kind, err := strconv.Atoi(fields[3])
+		if nil != err {
+			return nil, err
+		}
+
+		column := int(math.Floor(x * float64(nKeys) / 512))
+		if column < 0 {
+			column = 0
+		} else if column >= int(nKeys) {
+			column = int(nKeys) - 1
+		}
+
+		note := &game.Note{
+			Index: uint8(column),
+			Time:  time.Duration(t * float64(time.Millisecond)),
+		}
+
+		// Long notes keep their end time before the hit sample
+		if kind&128 != 0 && len(fields) > 5 {
+			tEnd, err := strconv.ParseFloat(strings.SplitN(fields[5], ":", 2)[0], 64)
+			if nil != err {
+				return nil, err
+			}
+			note.Kind = game.KindHold
+			note.TimeEnd = time.Duration(tEnd * float64(time.Millisecond))
+		}
+		notes = append(notes, note)
+	}
+
+	chart := p.buildChart(notes, points, game.Difficulty{
+		Type: game.ManiaKeyMode(nKeys),
+		Name: metadata["Version"],
+		// There is no meter, so use the overall difficulty instead
+		Msd:     difficulty["OverallDifficulty"],
+		Section: strings.Join(sections["HitObjects"], "\n"),
+		NKeys:   nKeys,
+	})
+	chart.Song = p.parseSong(filepath.Dir(file), general, metadata, sections["Events"])
+	return []*game.Chart{chart}, nil
+}
+
+// buildChart snaps, counts and sorts notes with times in ms, and adds the
+// measure lines and timing of the timing points
+func (p *OsuParser) buildChart(notes []*game.Note, points []timingPoint, difficulty game.Difficulty) *game.Chart {
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Time < notes[j].Time })
+
+	holdCount := 0
+	end := 0.0
+	for _, note := range notes {
+		t := float64(note.Time) / float64(time.Millisecond)
+		note.Denom = p.snap(points, t)
+		end = math.Max(end, t)
+		if note.TimeEnd != 0 {
+			end = math.Max(end, float64(note.TimeEnd)/float64(time.Millisecond))
+			holdCount++
+		}
+	}
+
+	noteCounts := make([]int64, difficulty.NKeys)
+	for i := 0; i < len(notes); {
+		j := i
+		for j < len(notes) && notes[j].Time == notes[i].Time {
+			j++
+		}
+		if j-i <= int(difficulty.NKeys) {
+			noteCounts[j-i-1]++
+		}
+		i = j
+	}
+	noteCountsAsStrings := make([]string, difficulty.NKeys)
+	for i, count := range noteCounts {
+		noteCountsAsStrings[i] = strconv.FormatInt(count, 10)
+	}
+
+	return &game.Chart{
+		Notes:               notes,
+		Measures:            p.buildMeasures(points, end),
+		NoteCounts:          noteCounts,
+		NoteCountsAsStrings: noteCountsAsStrings,
+		HoldCount:           int64(holdCount),
+		Difficulty:          difficulty,
+		Timing:              p.buildTiming(points),
+	}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const osuChart = `osu file format v14
+
+[General]
+AudioFilename: audio.mp3
+PreviewTime: 1500
+Mode: 3
+
+[Metadata]
+Title:Columns
+TitleUnicode:列
+Artist:Artist
+Creator:Mapper
+Version:4K Hard
+
+[Events]
+//Background and Video events
+0,0,"bg.jpg",0,0
+
+[Difficulty]
+CircleSize:4
+OverallDifficulty:8
+
+[TimingPoints]
+1000,500,4,2,0,100,1,0
+2000,-200,4,2,0,100,0,0
+
+[HitObjects]
+64,192,1000,1,0,0:0:0:0:
+448,192,1000,1,0,0:0:0:0:
+192,192,1250,1,0,0:0:0:0:
+320,192,1500,128,0,2500:0:0:0:0:
+`
+
+func TestParseOsu(t *testing.T) {
+	parser := OsuParser{}
+	file := writeChart(t, "map.osu", osuChart)
+	charts, err := parser.Parse(file)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 {
+		t.Fatal("expected 1 chart, got", len(charts))
+	}
+	chart := charts[0]
+	if chart.Difficulty.NKeys != 4 || chart.Difficulty.Name != "4K Hard" {
+		t.Log("Difficulty", chart.Difficulty)
+		t.Fail()
+	}
+	dir := filepath.Dir(file)
+	song := chart.Song
+	if song.Title != "列" || song.TitleTranslit != "Columns" || song.Credit != "Mapper" ||
+		song.Music != filepath.Join(dir, "audio.mp3") || song.Background != filepath.Join(dir, "bg.jpg") ||
+		song.SampleStart != 1500*time.Millisecond {
+		t.Log("Song", *song)
+		t.Fail()
+	}
+
+	expected := []struct {
+		Index   uint8
+		Denom   int
+		Time    time.Duration
+		TimeEnd time.Duration
+	}{
+		{Index: 0, Denom: 1, Time: 1000 * time.Millisecond},
+		{Index: 3, Denom: 1, Time: 1000 * time.Millisecond},
+		{Index: 1, Denom: 2, Time: 1250 * time.Millisecond},
+		{Index: 2, Denom: 1, Time: 1500 * time.Millisecond, TimeEnd: 2500 * time.Millisecond},
+	}
+	if len(chart.Notes) != len(expected) {
+		t.Fatal("expected", len(expected), "notes, got", len(chart.Notes))
+	}
+	for i, note := range chart.Notes {
+		e := expected[i]
+		if note.Index != e.Index || note.Denom != e.Denom || note.Time != e.Time || note.TimeEnd != e.TimeEnd {
+			t.Log("Note    ", *note)
+			t.Log("Expected", e)
+			t.Fail()
+		}
+	}
+	if chart.NoteCounts[0] != 2 || chart.NoteCounts[1] != 1 || chart.HoldCount != 1 {
+		t.Log("Counts", chart.NoteCounts, chart.HoldCount)
+		t.Fail()
+	}
+
+	// A measure every 4 beats, with beat lines in between
+	if len(chart.Measures) != 3 || chart.Measures[0].Denom != 1 || chart.Measures[1].Denom != 4 {
+		t.Log("Measures", len(chart.Measures))
+		t.Fail()
+	}
+
+	// The inherited point halves the scroll speed from beat 2
+	if d := chart.Timing.ScrollPosition(3000*time.Millisecond) - chart.Timing.ScrollPosition(2000*time.Millisecond); d != 500*time.Millisecond {
+		t.Log("Scrolled", d)
+		t.Log("Expected", 500*time.Millisecond)
+		t.Fail()
+	}
+}
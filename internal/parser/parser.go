@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+type Parser interface {
+	// Parse every playable chart in the file
+	Parse(file string) ([]*game.Chart, error)
+}
+
+// Extensions are the chart file extensions that can be parsed, in the order
+// they are preferred when a song has more than one
+var Extensions = []string{".ssc", ".sm", ".osu", ".qua", ".bms", ".bme", ".bml", ".pms"}
+
+// ForExtension returns the parser for chart files ending in ext
+func ForExtension(ext string) (Parser, bool) {
+	switch strings.ToLower(ext) {
+	case ".ssc":
+		return &SSCParser{}, true
+	case ".sm":
+		return &DefaultParser{}, true
+	case ".osu":
+		return &OsuParser{}, true
+	case ".qua":
+		return &QuaParser{}, true
+	case ".bms", ".bme", ".bml", ".pms":
+		return &BMSParser{}, true
+	}
+	return nil, false
+}
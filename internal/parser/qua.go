@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	"gopkg.in/yaml.v2"
+)
+
+// QuaParser reads Quaver .qua charts, which are YAML documents that hold
+// one chart each
+type QuaParser struct {
+	OsuParser
+}
+
+type quaChart struct {
+	AudioFile             string  `yaml:"AudioFile"`
+	SongPreviewTime       float64 `yaml:"SongPreviewTime"`
+	BackgroundFile        string  `yaml:"BackgroundFile"`
+	BannerFile            string  `yaml:"BannerFile"`
+	Title                 string  `yaml:"Title"`
+	Artist                string  `yaml:"Artist"`
+	Creator               string  `yaml:"Creator"`
+	Mode                  string  `yaml:"Mode"`
+	DifficultyName        string  `yaml:"DifficultyName"`
+	InitialScrollVelocity float64 `yaml:"InitialScrollVelocity"`
+	TimingPoints          []struct {
+		StartTime float64 `yaml:"StartTime"`
+		Bpm       float64 `yaml:"Bpm"`
+		Signature string  `yaml:"Signature"`
+	} `yaml:"TimingPoints"`
+	SliderVelocities []struct {
+		StartTime  float64 `yaml:"StartTime"`
+		Multiplier float64 `yaml:"Multiplier"`
+	} `yaml:"SliderVelocities"`
+	HitObjects []struct {
+		StartTime float64 `yaml:"StartTime"`
+		EndTime   float64 `yaml:"EndTime"`
+		Lane      int     `yaml:"Lane"`
+	} `yaml:"HitObjects"`
+}
+
+func (p *QuaParser) Parse(file string) ([]*game.Chart, error) {
+	data, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	var qua quaChart
+	if err := yaml.Unmarshal(data, &qua); nil != err {
+		return nil, err
+	}
+
+	// Modes are named Keys4 and Keys7
+	var nKeys uint8
+	switch qua.Mode {
+	case "Keys4":
+		nKeys = 4
+	case "Keys7":
+		nKeys = 7
+	default:
+		return []*game.Chart{}, nil
+	}
+
+	points := []timingPoint{}
+	if qua.InitialScrollVelocity != 0 && len(qua.TimingPoints) > 0 {
+		points = append(points, timingPoint{
+			time:            qua.TimingPoints[0].StartTime,
+			changesVelocity: true,
+			velocity:        qua.InitialScrollVelocity,
+		})
+	}
+	for _, tp := range qua.TimingPoints {
+		if tp.Bpm <= 0 {
+			continue
+		}
+		meter := 4
+		if tp.Signature == "Triple" {
+			meter = 3
+		}
+		points = append(points, timingPoint{
+			time:        tp.StartTime,
+			beatLength:  60000 / tp.Bpm,
+			meter:       meter,
+			uninherited: true,
+		})
+	}
+	for _, sv := range qua.SliderVelocities {
+		points = append(points, timingPoint{
+			time:            sv.StartTime,
+			changesVelocity: true,
+			velocity:        sv.Multiplier,
+		})
+	}
+	points = p.sortTimingPoints(points)
+
+	notes := []*game.Note{}
+	for _, object := range qua.HitObjects {
+		// Lanes start at 1
+		if object.Lane < 1 || object.Lane > int(nKeys) {
+			continue
+		}
+		note := &game.Note{
+			Index: uint8(object.Lane - 1),
+			Time:  time.Duration(object.StartTime * float64(time.Millisecond)),
+		}
+		if object.EndTime > object.StartTime {
+			note.Kind = game.KindHold
+			note.TimeEnd = time.Duration(object.EndTime * float64(time.Millisecond))
+		}
+		notes = append(notes, note)
+	}
+
+	// Hash the notes rather than the whole file, which has metadata
+	section := string(data)
+	if idx := strings.Index(section, "HitObjects:"); idx != -1 {
+		section = section[idx:]
+	}
+
+	chart := p.buildChart(notes, points, game.Difficulty{
+		Type:    game.ManiaKeyMode(nKeys),
+		Name:    qua.DifficultyName,
+		Section: section,
+		NKeys:   nKeys,
+	})
+
+	dir := filepath.Dir(file)
+	path := func(name string) string {
+		if name == "" {
+			return ""
+		}
+		return filepath.Join(dir, name)
+	}
+	chart.Song = &game.Song{
+		Title:       qua.Title,
+		Artist:      qua.Artist,
+		Credit:      qua.Creator,
+		Music:       path(qua.AudioFile),
+		Banner:      path(qua.BannerFile),
+		Background:  path(qua.BackgroundFile),
+		SampleStart: time.Duration(qua.SongPreviewTime * float64(time.Millisecond)),
+	}
+	return []*game.Chart{chart}, nil
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+const quaData = `AudioFile: audio.mp3
+Mode: Keys7
+Title: Lanes
+DifficultyName: Seven
+TimingPoints:
+- StartTime: 500
+  Bpm: 120
+SliderVelocities:
+- StartTime: 1500
+  Multiplier: 2
+HitObjects:
+- StartTime: 500
+  Lane: 1
+  KeySounds: []
+- StartTime: 750
+  Lane: 7
+  EndTime: 1500
+  KeySounds: []
+`
+
+func TestParseQua(t *testing.T) {
+	parser := QuaParser{}
+	charts, err := parser.Parse(writeChart(t, "map.qua", quaData))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 {
+		t.Fatal("expected 1 chart, got", len(charts))
+	}
+	chart := charts[0]
+	if chart.Difficulty.NKeys != 7 || chart.Difficulty.Name != "Seven" {
+		t.Log("Difficulty", chart.Difficulty)
+		t.Fail()
+	}
+	if len(chart.Notes) != 2 {
+		t.Fatal("expected 2 notes, got", len(chart.Notes))
+	}
+	first, second := chart.Notes[0], chart.Notes[1]
+	if first.Index != 0 || first.Time != 500*time.Millisecond || first.Denom != 1 {
+		t.Log("Note", *first)
+		t.Fail()
+	}
+	if second.Index != 6 || second.TimeEnd != 1500*time.Millisecond || second.Denom != 2 || chart.HoldCount != 1 {
+		t.Log("Note", *second)
+		t.Fail()
+	}
+	if d := chart.Timing.ScrollPosition(2000*time.Millisecond) - chart.Timing.ScrollPosition(1500*time.Millisecond); d != time.Second {
+		t.Log("Scrolled", d)
+		t.Log("Expected", time.Second)
+		t.Fail()
+	}
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// SSCParser reads StepMania 5 .ssc files, where each chart is a #NOTEDATA
+// block that can override the timing of the song
+type SSCParser struct {
+	DefaultParser
+}
+
+type tag struct {
+	key, value string
+}
+
+// parseTags splits a file into its #KEY:VALUE; tags, ignoring comments
+func (p *SSCParser) parseTags(data string) []tag {
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			lines[i] = line[:idx]
+		}
+	}
+	data = strings.Join(lines, "\n")
+
+	tags := []tag{}
+	for {
+		start := strings.IndexByte(data, '#')
+		if start == -1 {
+			break
+		}
+		data = data[start+1:]
+		colon := strings.IndexByte(data, ':')
+		if colon == -1 {
+			break
+		}
+		end := strings.IndexByte(data, ';')
+		if end == -1 {
+			end = len(data)
+		}
+		if colon > end {
+			// A tag without a value
+			data = data[end:]
+			continue
+		}
+		tags = append(tags, tag{
+			key:   strings.ToUpper(strings.TrimSpace(data[:colon])),
+			value: data[colon+1 : end],
+		})
+		data = data[end:]
+	}
+	return tags
+}
+
+func (p *SSCParser) Parse(file string) ([]*game.Chart, error) {
+	data, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	str := strings.ReplaceAll(string(data), "\r", "")
+	song := &game.Song{}
+	songTiming := &game.TimingData{}
+	charts := []*game.Chart{}
+
+	var difficulty *game.Difficulty
+	var timing *game.TimingData
+	playable := false
+
+	finish := func() {
+		if nil == difficulty || !playable {
+			return
+		}
+		timing.Init()
+		chart := p.parseChart(*difficulty, timing)
+		chart.Song = song
+		charts = append(charts, chart)
+	}
+
+	for _, t := range p.parseTags(str) {
+		if t.key == "NOTEDATA" {
+			finish()
+			// Each chart starts with the timing of the song, and any
+			// timing tags in the chart replace those of the song
+			chartTiming := *songTiming
+			timing = &chartTiming
+			difficulty = &game.Difficulty{}
+			playable = false
+			continue
+		}
+
+		if nil == difficulty {
+			isSong, err := p.parseSongTag(song, filepath.Dir(file), t.key, t.value)
+			if nil != err {
+				return nil, err
+			} else if isSong {
+				continue
+			}
+			if _, err := p.parseTimingTag(songTiming, t.key, t.value); nil != err {
+				return nil, err
+			}
+			continue
+		}
+
+		switch t.key {
+		case "STEPSTYPE":
+			difficulty.Type = strings.TrimSpace(t.value)
+			difficulty.NKeys, playable = game.NKeyMap[difficulty.Type]
+		case "DIFFICULTY":
+			difficulty.Name = strings.TrimSpace(t.value)
+		case "METER":
+			difficulty.Msd = strings.TrimSpace(t.value)
+		case "NOTES", "NOTES2":
+			difficulty.Section = strings.TrimLeft(t.value, "\n")
+		default:
+			if _, err := p.parseTimingTag(timing, t.key, t.value); nil != err {
+				return nil, err
+			}
+		}
+	}
+	finish()
+
+	return charts, nil
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+const sscChart = `#VERSION:0.83;
+#TITLE:Overrides;
+#OFFSET:0.000;
+#BPMS:0.000=120.000;
+#STOPS:;
+// A comment with a #TAG:in it;
+#NOTEDATA:;
+#STEPSTYPE:dance-single;
+#DIFFICULTY:Easy;
+#METER:3;
+#NOTES:
+1000
+0100
+0010
+0001
+;
+#NOTEDATA:;
+#STEPSTYPE:pump-single;
+#DIFFICULTY:Hard;
+#METER:9;
+#NOTES:
+10000
+00000
+00000
+00000
+;
+#NOTEDATA:;
+#STEPSTYPE:dance-single;
+#DIFFICULTY:Challenge;
+#METER:12;
+#OFFSET:0.500;
+#BPMS:0.000=240.000;
+#WARPS:1.000=1.500;
+#FAKES:3.000=1.000;
+#NOTES:
+1000
+0100
+0010
+0001
+,
+2000
+0000
+3000
+0000
+;
+`
+
+func TestParseSSC(t *testing.T) {
+	parser := SSCParser{}
+	charts, err := parser.Parse(writeChart(t, "chart.ssc", sscChart))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(charts) != 2 {
+		t.Fatal("expected 2 charts, got", len(charts))
+	}
+
+	tests := []struct {
+		Name  string
+		Msd   string
+		Times []time.Duration
+		Kinds []game.NoteKind
+	}{
+		{Name: "Easy", Msd: "3", Times: []time.Duration{
+			0, 500 * time.Millisecond, 1000 * time.Millisecond, 1500 * time.Millisecond,
+		}, Kinds: []game.NoteKind{
+			game.KindTap, game.KindTap, game.KindTap, game.KindTap,
+		}},
+		// The beat 2 note is warped over, and the beat 3 note is fake
+		{Name: "Challenge", Msd: "12", Times: []time.Duration{
+			-500 * time.Millisecond, -250 * time.Millisecond, -250 * time.Millisecond,
+			-125 * time.Millisecond, 125 * time.Millisecond,
+		}, Kinds: []game.NoteKind{
+			game.KindTap, game.KindTap, game.KindFake, game.KindFake, game.KindHold,
+		}},
+	}
+	for i, test := range tests {
+		chart := charts[i]
+		if chart.Difficulty.Name != test.Name || chart.Difficulty.Msd != test.Msd {
+			t.Log("Difficulty", chart.Difficulty.Name, chart.Difficulty.Msd)
+			t.Log("Expected  ", test.Name, test.Msd)
+			t.Fail()
+		}
+		if len(chart.Notes) != len(test.Times) {
+			t.Fatal("expected", len(test.Times), "notes, got", len(chart.Notes))
+		}
+		for j, note := range chart.Notes {
+			if note.Time != test.Times[j] || note.Kind != test.Kinds[j] {
+				t.Log("Note    ", test.Name, j, note.Time, note.Kind)
+				t.Log("Expected", test.Times[j], test.Kinds[j])
+				t.Fail()
+			}
+		}
+	}
+
+	if hold := charts[1].Notes[4]; hold.TimeEnd != 625*time.Millisecond {
+		t.Log("Hold end", hold.TimeEnd)
+		t.Log("Expected", 625*time.Millisecond)
+		t.Fail()
+	}
+}
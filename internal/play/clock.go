@@ -0,0 +1,89 @@
+package play
+
+import "time"
+
+// Clock is how far into the chart play has got
+type Clock interface {
+	Now() time.Duration
+}
+
+// WallClock is a Clock that runs in real time from Start
+type WallClock struct {
+	Start time.Time
+}
+
+func (c *WallClock) Now() time.Duration {
+	return time.Since(c.Start)
+}
+
+// VirtualClock is a Clock that only moves when it is advanced, so that a
+// chart can be played faster than real time
+type VirtualClock struct {
+	Time time.Duration
+}
+
+func (c *VirtualClock) Now() time.Duration {
+	return c.Time
+}
+
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.Time += d
+}
+
+// AudioClock is a Clock that follows the position of the music. The music
+// only reports a new position when its buffers are updated, so between
+// updates the Wall clock is followed, with the difference between the two
+// smoothed over updates. Before the music plays, and after it stops, only
+// the Wall clock is followed.
+type AudioClock struct {
+	Wall Clock
+
+	// Position is the time of the music, or false when it is not playing
+	Position func() (time.Duration, bool)
+
+	// Smoothing is the part of the drift corrected at each update, and Snap
+	// is the drift at which the clock jumps to the music instead
+	Smoothing float64
+	Snap      time.Duration
+
+	// Drift is how far the clock was from the music at the last update
+	Drift time.Duration
+
+	offset time.Duration // Added to the wall clock
+	locked bool          // Whether offset has been set by the music
+	last   time.Duration // The last position of the music
+	now    time.Duration
+}
+
+func NewAudioClock(wall Clock, position func() (time.Duration, bool)) *AudioClock {
+	return &AudioClock{
+		Wall:      wall,
+		Position:  position,
+		Smoothing: 0.1,
+		Snap:      100 * time.Millisecond,
+		last:      -1,
+	}
+}
+
+func (c *AudioClock) Now() time.Duration {
+	wall := c.Wall.Now()
+	if position, ok := c.Position(); ok && position != c.last {
+		c.last = position
+		// The music is at this position as it is updated, so compare it
+		// with the clock only then
+		target := position - wall
+		c.Drift = target - c.offset
+		if !c.locked || c.Drift > c.Snap || c.Drift < -c.Snap {
+			c.offset = target
+			c.locked = true
+		} else {
+			c.offset += time.Duration(float64(c.Drift) * c.Smoothing)
+		}
+	}
+
+	// Never go back in time, as notes would be judged twice
+	if now := wall + c.offset; now > c.now {
+		c.now = now
+	}
+	return c.now
+}
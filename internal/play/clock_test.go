@@ -0,0 +1,83 @@
+package play
+
+import (
+	"testing"
+	"time"
+)
+
+// music is a stream that started at start on the wall clock, and reports
+// its position late by latency, only every buffer
+type music struct {
+	wall    *VirtualClock
+	start   time.Duration
+	latency time.Duration
+	buffer  time.Duration
+}
+
+func (m *music) position() (time.Duration, bool) {
+	played := m.wall.Time - m.start - m.latency
+	if played < 0 {
+		return 0, m.wall.Time >= m.start
+	}
+	return played - played%m.buffer, true
+}
+
+func TestAudioClockFollowsMusic(t *testing.T) {
+	wall := &VirtualClock{}
+	m := &music{wall: wall, start: 500 * time.Millisecond, latency: 30 * time.Millisecond, buffer: 20 * time.Millisecond}
+	clock := NewAudioClock(wall, m.position)
+
+	var last time.Duration
+	for wall.Time < 10*time.Second {
+		wall.Advance(time.Millisecond)
+		now := clock.Now()
+		if now < last {
+			t.Fatal("Clock went back from", last, "to", now)
+		}
+		last = now
+
+		// Until the music plays, the clock is the wall clock
+		if wall.Time < m.start && now != wall.Time {
+			t.Fatal("Expected the wall clock before the music, got", now, "at", wall.Time)
+		}
+	}
+
+	// The music is at the wall time less its start and latency
+	expected := wall.Time - m.start - m.latency
+	if d := last - expected; d > m.buffer || d < -m.buffer {
+		t.Log("Clock   ", last)
+		t.Log("Expected", expected)
+		t.Fail()
+	}
+	if clock.Drift > m.buffer || clock.Drift < -m.buffer {
+		t.Log("Expected the drift to settle, got", clock.Drift)
+		t.Fail()
+	}
+}
+
+func TestAudioClockSnapsToMusic(t *testing.T) {
+	wall := &VirtualClock{}
+	m := &music{wall: wall, buffer: 10 * time.Millisecond}
+	clock := NewAudioClock(wall, m.position)
+
+	for wall.Time < time.Second {
+		wall.Advance(time.Millisecond)
+		clock.Now()
+	}
+	// The music stalls for 200ms, and the clock jumps back to it once the
+	// wall clock has caught up
+	m.latency = 200 * time.Millisecond
+	stalled := clock.Now()
+	for wall.Time < 1300*time.Millisecond {
+		wall.Advance(time.Millisecond)
+		if now := clock.Now(); now < stalled {
+			t.Fatal("Clock went back from", stalled, "to", now)
+		}
+	}
+	expected := wall.Time - m.latency
+	if d := clock.Now() - expected; d > m.buffer || d < -m.buffer {
+		t.Log("Clock   ", clock.Now())
+		t.Log("Expected", expected)
+		t.Fail()
+	}
+}
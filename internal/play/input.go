@@ -0,0 +1,131 @@
+package play
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// InputSource is where the inputs of a session come from
+type InputSource interface {
+	// Poll returns the inputs that happened by time now, which have not
+	// been returned before
+	Poll(now time.Duration) []game.Input
+}
+
+// Replay is an InputSource of inputs that are known ahead of time, such as
+// those of a saved score or the bot
+type Replay struct {
+	inputs []game.Input
+}
+
+func NewReplay(inputs []game.Input) *Replay {
+	r := &Replay{inputs: append([]game.Input{}, inputs...)}
+	sort.SliceStable(r.inputs, func(i, j int) bool { return r.inputs[i].HitTime < r.inputs[j].HitTime })
+	return r
+}
+
+func (r *Replay) Poll(now time.Duration) []game.Input {
+	n := 0
+	for n < len(r.inputs) && r.inputs[n].HitTime <= now {
+		n++
+	}
+	inputs := r.inputs[:n]
+	r.inputs = r.inputs[n:]
+	return inputs
+}
+
+// ReadInputs reads one input per line, as the time in ms, the column, and
+// then "release" for releases. Blank lines and lines starting with # are
+// skipped.
+func ReadInputs(r io.Reader) ([]game.Input, error) {
+	inputs := []game.Input{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %v: expected a time, a column and an optional release", line)
+		}
+		ms, err := strconv.ParseFloat(fields[0], 64)
+		if nil != err {
+			return nil, fmt.Errorf("line %v: invalid time: %w", line, err)
+		}
+		index, err := strconv.ParseUint(fields[1], 10, 8)
+		if nil != err {
+			return nil, fmt.Errorf("line %v: invalid column: %w", line, err)
+		}
+		input := game.Input{Index: uint8(index), HitTime: time.Duration(ms * float64(time.Millisecond))}
+		if len(fields) == 3 {
+			switch fields[2] {
+			case "release":
+				input.Release = true
+			case "press":
+			default:
+				return nil, fmt.Errorf("line %v: expected press or release, got %v", line, fields[2])
+			}
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, scanner.Err()
+}
+
+// KeyEvent is a key that was pressed or released at Time
+type KeyEvent struct {
+	Key     int32 // The raylib key code
+	Release bool
+	Time    time.Time
+}
+
+// Queue is an InputSource of key events that were timestamped as they
+// happened, so their timing does not depend on how often it is polled
+type Queue struct {
+	Events chan KeyEvent
+	Column func(key int32) (uint8, error)
+
+	now  func() time.Time
+	last time.Duration // The time of the last poll
+}
+
+func NewQueue(column func(key int32) (uint8, error)) *Queue {
+	return &Queue{
+		Events: make(chan KeyEvent, 256),
+		Column: column,
+		now:    time.Now,
+	}
+}
+
+func (q *Queue) Poll(now time.Duration) []game.Input {
+	inputs := []game.Input{}
+	polled := q.now()
+	for {
+		select {
+		case event := <-q.Events:
+			index, err := q.Column(event.Key)
+			if nil != err {
+				continue
+			}
+			// Events that were read after the last poll, but happened
+			// before it, are too late to be judged before then
+			t := now - polled.Sub(event.Time)
+			if t < q.last {
+				t = q.last
+			}
+			if t > now {
+				t = now
+			}
+			inputs = append(inputs, game.Input{Index: index, HitTime: t, Release: event.Release})
+		default:
+			q.last = now
+			return inputs
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package play
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+func TestReadInputs(t *testing.T) {
+	inputs, err := ReadInputs(strings.NewReader("# ms column\n1000 0\n\n1040.5 0 release\n1100 3 press\n"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	expected := []game.Input{
+		{Index: 0, HitTime: time.Second},
+		{Index: 0, HitTime: 1040500 * time.Microsecond, Release: true},
+		{Index: 3, HitTime: 1100 * time.Millisecond},
+	}
+	if len(inputs) != len(expected) {
+		t.Fatal("Inputs", inputs)
+	}
+	for i := range expected {
+		if inputs[i] != expected[i] {
+			t.Log("Input   ", inputs[i])
+			t.Log("Expected", expected[i])
+			t.Fail()
+		}
+	}
+
+	for _, invalid := range []string{"1000", "a 0", "1000 b", "1000 0 hold", "1000 0 release 1"} {
+		if _, err := ReadInputs(strings.NewReader(invalid)); nil == err {
+			t.Log("Expected an error for", invalid)
+			t.Fail()
+		}
+	}
+}
+
+func TestReplayPoll(t *testing.T) {
+	replay := NewReplay([]game.Input{
+		{Index: 1, HitTime: 2 * time.Second},
+		{Index: 0, HitTime: time.Second},
+	})
+	if inputs := replay.Poll(500 * time.Millisecond); len(inputs) != 0 {
+		t.Log("Expected no inputs, got", inputs)
+		t.Fail()
+	}
+	if inputs := replay.Poll(time.Second); len(inputs) != 1 || inputs[0].Index != 0 {
+		t.Log("Expected the input at 1s, got", inputs)
+		t.Fail()
+	}
+	if inputs := replay.Poll(3 * time.Second); len(inputs) != 1 || inputs[0].Index != 1 {
+		t.Log("Expected the input at 2s, got", inputs)
+		t.Fail()
+	}
+}
+
+func TestQueuePoll(t *testing.T) {
+	start := time.Unix(100, 0)
+	queue := NewQueue(func(key int32) (uint8, error) {
+		if key > 3 {
+			return 0, errors.New("key not mapped to index")
+		}
+		return uint8(key), nil
+	})
+	queue.now = func() time.Time { return start.Add(time.Second) }
+
+	queue.Events <- KeyEvent{Key: 1, Time: start.Add(990 * time.Millisecond)}
+	queue.Events <- KeyEvent{Key: 7, Time: start.Add(992 * time.Millisecond)}
+	queue.Events <- KeyEvent{Key: 1, Time: start.Add(995 * time.Millisecond), Release: true}
+	inputs := queue.Poll(5 * time.Second)
+	expected := []game.Input{
+		{Index: 1, HitTime: 4990 * time.Millisecond},
+		{Index: 1, HitTime: 4995 * time.Millisecond, Release: true},
+	}
+	if len(inputs) != len(expected) || inputs[0] != expected[0] || inputs[1] != expected[1] {
+		t.Log("Inputs  ", inputs)
+		t.Log("Expected", expected)
+		t.Fail()
+	}
+
+	// An event that happened before the last poll is judged at it
+	queue.now = func() time.Time { return start.Add(1100 * time.Millisecond) }
+	queue.Events <- KeyEvent{Key: 2, Time: start.Add(999 * time.Millisecond)}
+	if inputs := queue.Poll(5100 * time.Millisecond); len(inputs) != 1 || inputs[0].HitTime != 5*time.Second {
+		t.Log("Expected the late input at 5s, got", inputs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,68 @@
+package play
+
+import (
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// When a chart of a note every 100ms from 1s to 5.9s fails in each mode,
+// when only the first hits notes are hit, and maybe a mine at 6.5s too.
+// Notes are missed 181ms after they pass, and keys are never released, so
+// the mine is hit by the held key 75ms before it.
+var failTests = []struct {
+	fail     string
+	grade    string
+	hits     int
+	mine     bool
+	expected time.Duration
+}{
+	{fail: config.FailNormal, hits: 50, expected: 0},
+	{fail: config.FailNormal, hits: 0, expected: 1781 * time.Millisecond},
+	{fail: config.FailNormal, hits: 40, expected: 0},
+	{fail: config.FailNormal, hits: 40, mine: true, expected: 6425 * time.Millisecond},
+	{fail: config.FailOff, hits: 0, expected: 0},
+	{fail: config.FailSuddenDeath, hits: 50, mine: true, expected: 0},
+	{fail: config.FailSuddenDeath, hits: 20, expected: 3181 * time.Millisecond},
+	{fail: config.FailGrade, grade: "AAA", hits: 50, expected: 0},
+	{fail: config.FailGrade, grade: "A", hits: 40, expected: 5381 * time.Millisecond},
+}
+
+func TestFailModes(t *testing.T) {
+	defer func() { config.Fail = config.FailNormal }()
+
+	for _, test := range failTests {
+		config.Fail = test.fail
+		if test.grade != "" {
+			grade, err := config.GradeFor(test.grade)
+			if nil != err {
+				t.Fatal(err)
+			}
+			config.FailAt = grade
+		}
+
+		chart := &game.Chart{}
+		inputs := []game.Input{}
+		for i := 0; i < 50; i++ {
+			note := &game.Note{Index: uint8(i % 4), Time: time.Second + time.Duration(i)*100*time.Millisecond}
+			chart.Notes = append(chart.Notes, note)
+			if i < test.hits {
+				inputs = append(inputs, game.Input{Index: note.Index, HitTime: note.Time})
+			}
+		}
+		if test.mine {
+			chart.Notes = append(chart.Notes, &game.Note{Index: 0, Kind: game.KindMine, Time: 6500 * time.Millisecond})
+			inputs = append(inputs, game.Input{Index: 0, HitTime: 6500 * time.Millisecond})
+		}
+
+		s := simulate(t, chart, inputs)
+		if s.FailTime != test.expected {
+			t.Log("Mode    ", test.fail, test.grade, "with", test.hits, "hits")
+			t.Log("Failed  ", s.FailTime, "with", s.Life, "life")
+			t.Log("Expected", test.expected)
+			t.Fail()
+		}
+	}
+}
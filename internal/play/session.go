@@ -0,0 +1,288 @@
+package play
+
+import (
+	"math"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/score"
+)
+
+type EventKind uint8
+
+const (
+	EventHit    EventKind = iota // A press or release hit a note
+	EventEmpty                   // A press hit nothing
+	EventMiss                    // A note scrolled past without being hit
+	EventMine                    // A mine was hit
+	EventHoldOK                  // A hold or roll was kept until its end
+	EventHoldNG                  // A hold or roll was dropped
+	EventFail                    // The run failed
+)
+
+// Event is something that happened during an update, for the player to be
+// shown
+type Event struct {
+	Kind      EventKind
+	Index     uint8      // The column it happened in
+	Note      *game.Note // The note, for everything but empty presses
+	Distance  time.Duration
+	Judgement int // Index into config.Judgements of a hit or miss
+}
+
+// Session is the state of a chart being played, which advances by its
+// Clock and is played by its Input, without rendering anything
+type Session struct {
+	Chart  *game.Chart
+	Scorer score.Scorer
+	Clock  Clock
+	Input  InputSource
+	Rate   uint16
+
+	// Stats of the play so far
+	DistanceError, SumOfDistance time.Duration
+	Counts                       []int
+	Mean, Stdev                  float64
+	TotalHits                    uint64
+	WifePoints                   float64
+	OKCount, NGCount             int
+	MineHits                     int
+	JudgedNotes                  int
+	Inputs                       []game.Input
+	Life                         float64       // Percent of the life bar that is full
+	FailTime                     time.Duration // When the run failed, or 0 while it has not
+
+	notes int // Judged notes in the chart
+
+	now    time.Duration
+	down   map[uint8]time.Duration // Columns held down, since they were last checked for mines
+	missed int                     // Notes before this index have been checked for misses
+	holds  []*game.Note            // Hit holds and rolls that are not yet judged
+}
+
+func NewSession(chart *game.Chart, scorer score.Scorer, clock Clock, input InputSource, rate uint16) *Session {
+	notes := 0
+	for _, note := range chart.Notes {
+		if note.IsJudged() {
+			notes++
+		}
+	}
+	return &Session{
+		Chart:  chart,
+		Scorer: scorer,
+		Clock:  clock,
+		Input:  input,
+		Rate:   rate,
+		Counts: make([]int, len(config.Judgements)),
+		Inputs: []game.Input{},
+		Life:   50,
+		down:   map[uint8]time.Duration{},
+		notes:  notes,
+	}
+}
+
+// Time is the time of the last update
+func (s *Session) Time() time.Duration {
+	return s.now
+}
+
+// Down is whether the key of a column is held down
+func (s *Session) Down(index uint8) bool {
+	_, ok := s.down[index]
+	return ok
+}
+
+// Done is whether the run failed or every note has scrolled past
+func (s *Session) Done() bool {
+	_, start, _ := s.Chart.Active()
+	return s.FailTime != 0 || start >= len(s.Chart.Notes)
+}
+
+// Update applies the inputs up to the time of the clock, judges the notes
+// that were missed or held by then, and slides the start of the active
+// window past the notes that are over. Nothing happens after a run fails.
+func (s *Session) Update() []Event {
+	if s.FailTime != 0 {
+		return nil
+	}
+	s.now = s.Clock.Now()
+	events := []Event{}
+
+	for _, input := range s.Input.Poll(s.now) {
+		// Mines are hit by any key that is down, before presses are judged
+		if since, ok := s.down[input.Index]; ok {
+			events = s.hitMines(events, input.Index, since, input.HitTime)
+		}
+		if input.Release {
+			delete(s.down, input.Index)
+		} else {
+			events = s.hitMines(events, input.Index, input.HitTime, input.HitTime)
+			s.down[input.Index] = input.HitTime
+		}
+		events = s.applyInput(events, input)
+	}
+	for index, since := range s.down {
+		events = s.hitMines(events, index, since, s.now)
+		s.down[index] = s.now
+	}
+
+	events = s.miss(events)
+	events = s.judgeHolds(events)
+	s.slide()
+	if s.FailTime != 0 {
+		events = append(events, Event{Kind: EventFail})
+	}
+	return events
+}
+
+func (s *Session) hitMines(events []Event, index uint8, from, to time.Duration) []Event {
+	for _, mine := range s.Scorer.HitMines(s.Chart, index, from, to, s.Rate) {
+		s.MineHits++
+		s.WifePoints += score.WifeMineHitWeight
+		s.changeLife(config.LifeMine, false, to)
+		events = append(events, Event{Kind: EventMine, Index: index, Note: mine})
+	}
+	return events
+}
+
+func (s *Session) applyInput(events []Event, input game.Input) []Event {
+	s.Inputs = append(s.Inputs, input)
+
+	note, distance, abs := s.Scorer.ApplyInputToChart(s.Chart, &input, s.Rate)
+	if note == nil {
+		if input.Release {
+			return events
+		}
+		return append(events, Event{Kind: EventEmpty, Index: input.Index})
+	}
+	// A press in the miss window takes the note, as a miss
+	if note.HitTime == 0 {
+		return s.missNote(events, note, input.HitTime)
+	}
+
+	s.DistanceError += abs
+	s.TotalHits += 1
+	s.SumOfDistance += distance
+	// because distance is < missDistance, this should never be the miss
+	idx := config.Judge.Index(abs)
+	note.Judgement = &config.Judgements[idx]
+	if note.TimeEnd != 0 {
+		s.holds = append(s.holds, note)
+	}
+
+	s.Counts[idx]++
+	s.WifePoints += score.WifePoints(distance, config.Judge.Scale)
+	s.JudgedNotes++
+	s.changeLife(config.LifeFor(idx), false, input.HitTime)
+	if s.TotalHits > 1 {
+		s.Stdev = 0.0
+		s.Mean = float64(s.SumOfDistance) / float64(s.TotalHits)
+		for _, n := range s.Chart.Notes {
+			if n.HitTime == 0 || !n.IsJudged() {
+				continue
+			}
+			diff := s.Scorer.Distance(s.Rate, n.Time, n.HitTime)
+			xi := float64(diff) - s.Mean
+			s.Stdev += xi * xi
+		}
+		s.Stdev /= float64(s.TotalHits - 1)
+		s.Stdev = math.Sqrt(s.Stdev)
+	}
+
+	return append(events, Event{Kind: EventHit, Index: input.Index, Note: note, Distance: distance, Judgement: idx})
+}
+
+// changeLife changes the life by delta at time t, and fails the run there
+// if it fails by the fail mode
+func (s *Session) changeLife(delta float64, miss bool, t time.Duration) {
+	s.Life = math.Max(0, math.Min(100, s.Life+delta))
+	if s.FailTime != 0 {
+		return
+	}
+
+	failed := false
+	switch config.Fail {
+	case config.FailNormal:
+		failed = s.Life <= 0
+	case config.FailSuddenDeath:
+		failed = miss
+	case config.FailGrade:
+		// The best accuracy left is with every note still to come perfect
+		best := s.WifePoints + float64(s.notes-s.JudgedNotes)*score.WifeMaxPoints
+		failed = s.notes > 0 && score.WifePercent(best, s.notes) < config.FailAt.Wife
+	}
+	if failed {
+		s.FailTime = t
+	}
+}
+
+// passed is whether chart time t can no longer be hit
+func (s *Session) passed(t time.Duration) bool {
+	return s.Scorer.Distance(s.Rate, t, s.now) < -config.Judge.MissWindow()
+}
+
+// miss judges the notes that scrolled past without being hit, in time order
+func (s *Session) miss(events []Event) []Event {
+	for ; s.missed < len(s.Chart.Notes); s.missed++ {
+		note := s.Chart.Notes[s.missed]
+		if !s.passed(note.Time) {
+			break
+		}
+		if note.HitTime != 0 || note.MissTime != 0 || !note.IsJudged() {
+			continue
+		}
+		note.MissTime = s.now
+		events = s.missNote(events, note, s.now)
+	}
+	return events
+}
+
+// missNote judges note as missed at time t
+func (s *Session) missNote(events []Event, note *game.Note, t time.Duration) []Event {
+	idx := len(s.Counts) - 1
+	s.Counts[idx]++
+	s.WifePoints += score.WifeMissWeight
+	s.JudgedNotes++
+	s.changeLife(config.LifeFor(idx), true, t)
+	return append(events, Event{Kind: EventMiss, Index: note.Index, Note: note, Judgement: idx})
+}
+
+func (s *Session) judgeHolds(events []Event) []Event {
+	pending := s.holds[:0]
+	for _, note := range s.holds {
+		switch s.Scorer.JudgeHold(note, s.now, s.Rate) {
+		case game.HoldOK:
+			s.OKCount++
+			s.changeLife(config.LifeHoldOK, false, s.now)
+			events = append(events, Event{Kind: EventHoldOK, Index: note.Index, Note: note})
+		case game.HoldNG:
+			s.NGCount++
+			s.WifePoints += score.WifeHoldDropWeight
+			s.changeLife(config.LifeHoldNG, false, s.now)
+			events = append(events, Event{Kind: EventHoldNG, Index: note.Index, Note: note})
+		default:
+			pending = append(pending, note)
+		}
+	}
+	s.holds = pending
+	return events
+}
+
+// slide moves the start of the active window past the notes that are over.
+// A hold is only over once its end has passed too, so it stays active, and
+// keeps the notes after it active, while it spans the hit bar.
+func (s *Session) slide() {
+	_, start, end := s.Chart.Active()
+	for start < len(s.Chart.Notes) {
+		note := s.Chart.Notes[start]
+		if !s.passed(note.Time) || (note.TimeEnd != 0 && !s.passed(note.TimeEnd)) {
+			break
+		}
+		start++
+	}
+	if end < start {
+		end = start
+	}
+	s.Chart.SetActive(start, end)
+}
@@ -0,0 +1,159 @@
+package play
+
+import (
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/score"
+)
+
+func simulate(t *testing.T, chart *game.Chart, inputs []game.Input) *Session {
+	if err := config.SetJudge("J4"); nil != err {
+		t.Fatal(err)
+	}
+	config.MineWindow = 75 * time.Millisecond
+	config.HoldWindow = 250 * time.Millisecond
+
+	clock := &VirtualClock{}
+	s := NewSession(chart, &score.DefaultScorer{}, clock, NewReplay(inputs), 100)
+	Simulate(s, clock, time.Millisecond)
+	return s
+}
+
+func TestSessionHitsAndMisses(t *testing.T) {
+	chart := &game.Chart{Notes: []*game.Note{
+		{Index: 0, Time: time.Second},
+		{Index: 1, Time: 2 * time.Second},
+		{Index: 2, Time: 3 * time.Second},
+	}}
+	s := simulate(t, chart, []game.Input{
+		{Index: 0, HitTime: time.Second},
+		{Index: 1, HitTime: 2*time.Second + 30*time.Millisecond},
+		{Index: 3, HitTime: 3 * time.Second},
+	})
+
+	last := len(s.Counts) - 1
+	if s.TotalHits != 2 || s.Counts[0] != 1 || s.Counts[last] != 1 || s.JudgedNotes != 3 {
+		t.Log("Counts", s.Counts, "hits", s.TotalHits, "judged", s.JudgedNotes)
+		t.Fail()
+	}
+	if chart.Notes[2].MissTime == 0 {
+		t.Log("Expected the last note to be missed")
+		t.Fail()
+	}
+	if len(s.Inputs) != 3 {
+		t.Log("Inputs", s.Inputs)
+		t.Fail()
+	}
+}
+
+func TestSessionHoldStaysActive(t *testing.T) {
+	// Taps scroll past while a hold in another column spans the hit bar
+	chart := &game.Chart{Notes: []*game.Note{
+		{Index: 0, Kind: game.KindHold, Time: time.Second, TimeEnd: 5 * time.Second},
+		{Index: 1, Time: 1100 * time.Millisecond},
+		{Index: 1, Time: 1200 * time.Millisecond},
+		{Index: 1, Time: 1300 * time.Millisecond},
+		{Index: 1, Time: 6 * time.Second},
+	}}
+	if err := config.SetJudge("J4"); nil != err {
+		t.Fatal(err)
+	}
+	clock := &VirtualClock{}
+	s := NewSession(chart, &score.DefaultScorer{}, clock, NewReplay([]game.Input{
+		{Index: 0, HitTime: time.Second},
+	}), 100)
+
+	for clock.Time < 3*time.Second {
+		clock.Advance(time.Millisecond)
+		s.Update()
+	}
+	// The end of the window is only slid by rendering
+	if _, start, _ := chart.Active(); start != 0 {
+		t.Log("Expected the hold to still be active, the window starts at", start)
+		t.Fail()
+	}
+
+	for clock.Time < 5500*time.Millisecond {
+		clock.Advance(time.Millisecond)
+		s.Update()
+	}
+	if _, start, _ := chart.Active(); start != 4 {
+		t.Log("Expected the window to start after the hold, it starts at", start)
+		t.Fail()
+	}
+	if s.OKCount != 1 {
+		t.Log("Expected the hold to be OK, got", s.OKCount, "OK and", s.NGCount, "NG")
+		t.Fail()
+	}
+}
+
+// The events of holding column 0 from 500ms for a while, on a chart with a
+// mine at 1s and a hold from 2s to 3s
+var heldTests = []struct {
+	release time.Duration
+	mines   int
+	ok, ng  int
+}{
+	{release: 600 * time.Millisecond, mines: 0, ok: 0, ng: 0},
+	{release: 1500 * time.Millisecond, mines: 1, ok: 0, ng: 0},
+	{release: 2500 * time.Millisecond, mines: 1, ok: 0, ng: 1},
+	{release: 4 * time.Second, mines: 1, ok: 1, ng: 0},
+}
+
+func TestSessionHeldKeys(t *testing.T) {
+	for _, test := range heldTests {
+		chart := &game.Chart{Notes: []*game.Note{
+			{Index: 0, Kind: game.KindMine, Time: time.Second},
+			{Index: 0, Kind: game.KindHold, Time: 2 * time.Second, TimeEnd: 3 * time.Second},
+		}}
+		inputs := []game.Input{
+			{Index: 0, HitTime: 500 * time.Millisecond},
+			{Index: 0, HitTime: test.release, Release: true},
+		}
+		if test.release > 2*time.Second {
+			// Press again to hit the hold
+			inputs = []game.Input{
+				{Index: 0, HitTime: 500 * time.Millisecond},
+				{Index: 0, HitTime: 1900 * time.Millisecond, Release: true},
+				{Index: 0, HitTime: 2 * time.Second},
+				{Index: 0, HitTime: test.release, Release: true},
+			}
+		}
+		s := simulate(t, chart, inputs)
+		if s.MineHits != test.mines || s.OKCount != test.ok || s.NGCount != test.ng {
+			t.Log("Release ", test.release)
+			t.Log("Mines   ", s.MineHits, "expected", test.mines)
+			t.Log("OK      ", s.OKCount, "expected", test.ok)
+			t.Log("NG      ", s.NGCount, "expected", test.ng)
+			t.Fail()
+		}
+	}
+}
+
+func TestSessionAfterReset(t *testing.T) {
+	chart := &game.Chart{Notes: []*game.Note{
+		{Index: 0, Time: time.Second},
+		{Index: 0, Kind: game.KindHold, Time: 2 * time.Second, TimeEnd: 3 * time.Second},
+		{Index: 1, Time: 4 * time.Second},
+	}}
+	inputs := []game.Input{
+		{Index: 0, HitTime: time.Second},
+		{Index: 0, HitTime: 1050 * time.Millisecond, Release: true},
+		{Index: 0, HitTime: 2 * time.Second},
+		{Index: 0, HitTime: 3 * time.Second, Release: true},
+	}
+	first := simulate(t, chart, inputs)
+
+	// A restarted chart plays the same as a new one
+	chart.Reset()
+	second := simulate(t, chart, inputs)
+	if first.TotalHits != 2 || second.TotalHits != first.TotalHits ||
+		second.OKCount != first.OKCount || second.WifePoints != first.WifePoints {
+		t.Log("First ", first.TotalHits, first.OKCount, first.WifePoints)
+		t.Log("Second", second.TotalHits, second.OKCount, second.WifePoints)
+		t.Fail()
+	}
+}
@@ -0,0 +1,12 @@
+package play
+
+import "time"
+
+// Simulate plays a session to the end of its chart, advancing clock by step
+// between updates, as fast as it can
+func Simulate(s *Session, clock *VirtualClock, step time.Duration) {
+	for !s.Done() {
+		clock.Advance(step)
+		s.Update()
+	}
+}
@@ -0,0 +1,142 @@
+package score
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// legacyClosestNote is how GetClosestNote found notes before columns were
+// indexed, by filtering every note of the chart and binary searching them
+func (s *DefaultScorer) legacyClosestNote(chart *game.Chart, input *game.Input, rate uint16) (note *game.Note, distance, abs time.Duration) {
+	targets := make([]*game.Note, 0, len(chart.Notes))
+	for _, note := range chart.Notes {
+		if note.Index == input.Index && isTarget(note, input) {
+			targets = append(targets, note)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	note, distance, abs = s.searchClosest(targets, input, rate, 0, len(targets)-1)
+	if abs < s.preset().HitWindow() {
+		note.HitTime = input.HitTime
+		return
+	}
+	return nil, 0, 0
+}
+
+func (s *DefaultScorer) searchClosest(targets []*game.Note, input *game.Input, rate uint16, start, end int) (note *game.Note, distance, absDistance time.Duration) {
+	if start == end {
+		distance = s.Distance(rate, targets[start].Time, input.HitTime)
+		return targets[start], distance, abs(distance)
+	}
+	if start == end-1 {
+		note = targets[start]
+		distance = s.Distance(rate, targets[start].Time, input.HitTime)
+		absDistance = abs(distance)
+		endDistance := s.Distance(rate, targets[end].Time, input.HitTime)
+		if absDistance > abs(endDistance) {
+			return targets[end], endDistance, abs(endDistance)
+		}
+		return
+	}
+	mid := (start + end) / 2
+	if s.Distance(rate, targets[mid].Time, input.HitTime) > 0 {
+		return s.searchClosest(targets, input, rate, start, mid)
+	}
+	return s.searchClosest(targets, input, rate, mid, end)
+}
+
+// stream is a 4k chart of notes every 25ms, with every 50th note a mine,
+// and an input for every note that is up to 60ms off
+func stream(n int) ([]*game.Note, []game.Input) {
+	r := rand.New(rand.NewSource(1))
+	notes := make([]*game.Note, n)
+	inputs := make([]game.Input, 0, n)
+	for i := range notes {
+		notes[i] = &game.Note{Index: uint8(r.Intn(4)), Time: time.Second + time.Duration(i)*25*time.Millisecond}
+		if i%50 == 0 {
+			notes[i].Kind = game.KindMine
+			continue
+		}
+		offset := time.Duration(r.Int63n(int64(120*time.Millisecond))) - 60*time.Millisecond
+		inputs = append(inputs, game.Input{Index: notes[i].Index, HitTime: notes[i].Time + offset})
+	}
+	return notes, inputs
+}
+
+func TestClosestNoteMatchesLegacy(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 90 * time.Millisecond}, {Time: 180 * time.Millisecond}, {}}
+	scorer := DefaultScorer{}
+
+	notes, inputs := stream(2000)
+	legacy := make([]*game.Note, len(notes))
+	for i, note := range notes {
+		n := *note
+		legacy[i] = &n
+	}
+	chart := &game.Chart{Notes: notes}
+	legacyChart := &game.Chart{Notes: legacy}
+
+	for _, input := range inputs {
+		note, distance, _ := scorer.GetClosestNote(chart, &input, 100)
+		expected, expectedDistance, _ := scorer.legacyClosestNote(legacyChart, &input, 100)
+		if (nil == note) != (nil == expected) || (nil != note && (note.Time != expected.Time || distance != expectedDistance)) {
+			t.Log("Input   ", input)
+			t.Log("Note    ", note, distance)
+			t.Log("Expected", expected, expectedDistance)
+			t.Fail()
+		}
+	}
+}
+
+func TestClosestNoteSingleTarget(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+	scorer := DefaultScorer{}
+
+	chart := &game.Chart{Notes: []*game.Note{{Index: 0, Time: time.Second}}}
+	if note, _, _ := scorer.GetClosestNote(chart, &game.Input{Index: 1, HitTime: time.Second}, 100); nil != note {
+		t.Log("Expected no note in an empty column, got", note)
+		t.Fail()
+	}
+	if note, _, _ := scorer.GetClosestNote(chart, &game.Input{HitTime: 1100 * time.Millisecond}, 100); note != chart.Notes[0] {
+		t.Log("Expected the only note to be hit, got", note)
+		t.Fail()
+	}
+	if note, _, _ := scorer.GetClosestNote(chart, &game.Input{HitTime: time.Second}, 100); nil != note {
+		t.Log("Expected the note to only be hit once, got", note)
+		t.Fail()
+	}
+}
+
+func benchmarkClosestNote(b *testing.B, closest func(*DefaultScorer, *game.Chart, *game.Input, uint16) (*game.Note, time.Duration, time.Duration)) {
+	config.Judgements = []game.Judgement{{Time: 90 * time.Millisecond}, {Time: 180 * time.Millisecond}, {}}
+	scorer := DefaultScorer{}
+	notes, inputs := stream(5000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Play the whole chart each time
+		for _, note := range notes {
+			note.HitTime = 0
+		}
+		chart := &game.Chart{Notes: notes}
+		for j := range inputs {
+			closest(&scorer, chart, &inputs[j], 100)
+		}
+	}
+}
+
+func BenchmarkClosestNote(b *testing.B) {
+	benchmarkClosestNote(b, (*DefaultScorer).GetClosestNote)
+}
+
+func BenchmarkClosestNoteLegacy(b *testing.B) {
+	benchmarkClosestNote(b, (*DefaultScorer).legacyClosestNote)
+}
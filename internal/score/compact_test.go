@@ -1,6 +1,7 @@
 package score
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -19,6 +20,9 @@ var compactTests = map[*([]game.Input)]([]InputsCompact){
 		{Index: 0, Times: []time.Duration{}},
 		{Index: 1, Times: []time.Duration{2, 1}},
 	},
+	{{Index: 0, HitTime: 100}, {Index: 0, HitTime: 150, Release: true}, {Index: 0, HitTime: 200}}: {
+		{Index: 0, Times: []time.Duration{100, 200}, Releases: []time.Duration{150}},
+	},
 }
 
 func TestCompactInputs(t *testing.T) {
@@ -39,6 +43,14 @@ func TestCompactInputs(t *testing.T) {
 					return false
 				}
 			}
+			if len(pi.Releases) != len(qi.Releases) {
+				return false
+			}
+			for j := 0; j < len(pi.Releases); j++ {
+				if pi.Releases[j] != qi.Releases[j] {
+					return false
+				}
+			}
 		}
 		return true
 	}
@@ -69,7 +81,7 @@ func TestUncompactInputs(t *testing.T) {
 			if p[i].Index != q[i].Index {
 				return false
 			}
-			if p[i].HitTime != q[i].HitTime {
+			if p[i].HitTime != q[i].HitTime || p[i].Release != q[i].Release {
 				return false
 			}
 		}
@@ -85,3 +97,23 @@ func TestUncompactInputs(t *testing.T) {
 		}
 	}
 }
+
+func TestUncompactLegacyInputs(t *testing.T) {
+	// Rows saved before releases were stored
+	var ins []InputsCompact
+	if err := json.Unmarshal([]byte(`[{"Index":0,"Times":[100,300]},{"Index":1,"Times":[200]}]`), &ins); nil != err {
+		t.Fatal(err)
+	}
+	expected := []game.Input{{Index: 0, HitTime: 100}, {Index: 0, HitTime: 300}, {Index: 1, HitTime: 200}}
+	out := *uncompactInputs(ins)
+	if len(out) != len(expected) {
+		t.Fatal("expected", expected, "got", out)
+	}
+	for i := range out {
+		if out[i] != expected[i] {
+			t.Log("out     ", out)
+			t.Log("expected", expected)
+			t.Fail()
+		}
+	}
+}
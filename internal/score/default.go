@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"git.lost.host/meutraa/eotw/internal/config"
@@ -14,18 +17,22 @@ import (
 )
 
 type DefaultScorer struct {
-	db *sql.DB
+	db    *sql.DB
+	judge *config.JudgePreset // The preset from config is used when nil
 }
 
+// InputsCompact is the presses and releases of one column, which are
+// stored as JSON. Scores from before releases were stored have none.
 type InputsCompact struct {
-	Index uint8
-	Times []time.Duration
+	Index    uint8
+	Times    []time.Duration // Presses
+	Releases []time.Duration `json:",omitempty"`
 }
 
 func compactInputs(inputs *[]game.Input) []InputsCompact {
 	colCount := uint8(0)
 	for _, i := range *inputs {
-		if i.Index > colCount {
+		if i.Index >= colCount {
 			colCount = i.Index + 1
 		}
 	}
@@ -35,27 +42,99 @@ func compactInputs(inputs *[]game.Input) []InputsCompact {
 	}
 	for _, i := range *inputs {
 		ins[i.Index].Index = i.Index // Repeated but it does not matter
-		ins[i.Index].Times = append(ins[i.Index].Times, i.HitTime)
+		if i.Release {
+			ins[i.Index].Releases = append(ins[i.Index].Releases, i.HitTime)
+		} else {
+			ins[i.Index].Times = append(ins[i.Index].Times, i.HitTime)
+		}
 	}
 	return ins
 }
 
+// uncompactInputs is the inputs of each column in turn, with the presses
+// and releases of a column merged in the order they happened
 func uncompactInputs(inputs []InputsCompact) *[]game.Input {
 	ins := []game.Input{}
 	for _, i := range inputs {
-		for _, t := range i.Times {
-			ins = append(ins, game.Input{Index: i.Index, HitTime: t})
+		presses, releases := i.Times, i.Releases
+		for len(presses) > 0 || len(releases) > 0 {
+			if len(releases) == 0 || (len(presses) > 0 && presses[0] <= releases[0]) {
+				ins = append(ins, game.Input{Index: i.Index, HitTime: presses[0]})
+				presses = presses[1:]
+			} else {
+				ins = append(ins, game.Input{Index: i.Index, HitTime: releases[0], Release: true})
+				releases = releases[1:]
+			}
 		}
 	}
 	return &ins
 }
 
+// migrations bring an older scores db up to date, in order, and the number
+// that have been applied is stored as the user_version of the db
+var migrations = []string{
+	// Scores are keyed by the canonical hash, and alias keeps the hash of
+	// the chart text that older versions used
+	`alter table scores add column alias text`,
+	// The judge preset that the score was played with
+	`alter table scores add column judge text`,
+	`alter table scores add column failed integer`,
+	`alter table scores add column pauses integer`,
+	// Scores that are still keyed by the hash of the chart text keep it as
+	// their alias too, which is how they are found and rekeyed once their
+	// chart is parsed, as the canonical hash is only known then
+	`update scores set alias = sum where alias is null`,
+	// The library of songs is only a cache, so one from before it was
+	// migrated is dropped and scanned again
+	`drop table if exists charts`,
+	`drop table if exists songs`,
+	`create table songs
+	  (
+		  directory text not null primary key,
+		  root text not null,
+		  pack text,
+		  changed integer,
+		  files text,
+		  modified integer,
+		  title text,
+		  artist text,
+		  audio text
+	  )`,
+	`create table charts
+	  (
+		  directory text not null,
+		  position integer not null,
+		  sum text,
+		  song text,
+		  type text,
+		  name text,
+		  meter text,
+		  keys integer,
+		  counts text,
+		  holds integer,
+		  mines integer,
+		  primary key (directory, position)
+	  )`,
+	`create index songs_root on songs (root)`,
+}
+
 func (s *DefaultScorer) Init() error {
 	db, err := sql.Open("sqlite3", "./scores.db")
 	if err != nil {
 		return err
 	}
 
+	if err := Migrate(db); nil != err {
+		return err
+	}
+
+	s.db = db
+	return nil
+}
+
+// Migrate creates the tables of the scores db, which also has the library of
+// songs in it, or brings them up to date
+func Migrate(db *sql.DB) error {
 	initStatement := `
 	create table if not exists scores 
 	  (
@@ -65,52 +144,144 @@ func (s *DefaultScorer) Init() error {
 		  inputs bytearray
 	  );
 	`
-	_, err = db.Exec(initStatement)
-	if nil != err {
-		return nil
+	if _, err := db.Exec(initStatement); nil != err {
+		return err
 	}
 
-	s.db = db
+	var version int
+	if err := db.QueryRow("pragma user_version").Scan(&version); nil != err {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := db.Exec(migrations[i]); nil != err {
+			return fmt.Errorf("unable to migrate scores to version %v: %w", i+1, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("pragma user_version = %v", i+1)); nil != err {
+			return err
+		}
+	}
 	return nil
 }
 
+// preset is the judge preset that this scorer judges notes by
+func (s *DefaultScorer) preset() *config.JudgePreset {
+	if nil != s.judge {
+		return s.judge
+	}
+	if nil != config.Judge {
+		return config.Judge
+	}
+	// Before config is initialised, judge by the judge 4 windows
+	return &config.JudgePreset{Name: "J4", Judgements: config.Judgements, Scale: 1}
+}
+
+// DB is the database that the scores are in, which other state of the game
+// can be kept in as well
+func (s *DefaultScorer) DB() *sql.DB {
+	return s.db
+}
+
 func (s *DefaultScorer) Deinit() {
 	if nil != s.db {
 		s.db.Close()
 	}
 }
 
-func (s *DefaultScorer) hashChart(c *game.Chart) string {
+// canonicalChart is a form of the chart that only depends on its notes and
+// timing, and not the format or layout of the file it was parsed from
+func (s *DefaultScorer) canonicalChart(c *game.Chart) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", c.Difficulty.Type)
+
+	// Beats are rounded so that float error does not change the hash
+	beat := func(d time.Duration) string {
+		if nil == c.Timing {
+			return fmt.Sprintf("%d", d.Milliseconds())
+		}
+		return fmt.Sprintf("%.3f", c.Timing.TimeToBeat(d))
+	}
+	if nil != c.Timing {
+		for _, bpm := range c.Timing.BPMs {
+			fmt.Fprintf(&b, "bpm %.3f=%.3f\n", bpm.StartingBeat, bpm.Value)
+		}
+		for _, stop := range c.Timing.Stops {
+			fmt.Fprintf(&b, "stop %.3f=%.3f\n", stop.StartingBeat, stop.Duration)
+		}
+		for _, delay := range c.Timing.Delays {
+			fmt.Fprintf(&b, "delay %.3f=%.3f\n", delay.StartingBeat, delay.Duration)
+		}
+	}
+
+	notes := make([]string, len(c.Notes))
+	for i, note := range c.Notes {
+		notes[i] = fmt.Sprintf("%v %v %v", beat(note.Time), note.Index, note.Kind)
+		if note.TimeEnd != 0 {
+			notes[i] += " " + beat(note.TimeEnd)
+		}
+	}
+	// Notes on the same row can be in any order
+	sort.Strings(notes)
+	b.WriteString(strings.Join(notes, "\n"))
+	return b.String()
+}
+
+// Hash is the hash of the canonical chart, which its scores are keyed by
+func (s *DefaultScorer) Hash(c *game.Chart) string {
+	sum := sha256.Sum256([]byte(s.canonicalChart(c)))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// legacyHashChart is the hash of the chart text, which scores were keyed by
+// before the canonical hash
+func (s *DefaultScorer) legacyHashChart(c *game.Chart) string {
 	sum := sha256.Sum256([]byte(c.Difficulty.Section))
 	return base64.StdEncoding.EncodeToString(sum[:])
 }
 
-func (s *DefaultScorer) Save(c *game.Chart, inputs *[]game.Input, rate uint16) {
-	data, err := json.Marshal(compactInputs(inputs))
+func (s *DefaultScorer) Save(c *game.Chart, history *History) {
+	data, err := json.Marshal(compactInputs(history.Inputs))
 	if nil != err {
 		log.Println("unable to marshal notes", err)
 		return
 	}
-	_, err = s.db.Exec("insert into scores(sum, rate, inputs) values(?, ?, ?)", s.hashChart(c), rate, data)
+	result, err := s.db.Exec(
+		"insert into scores(sum, alias, rate, inputs, judge, failed, pauses) values(?, ?, ?, ?, ?, ?, ?)",
+		s.Hash(c), s.legacyHashChart(c), history.Rate, data, s.preset().Name, int64(history.Failed), history.Pauses,
+	)
 	if nil != err {
 		log.Println("unable to save score")
 		return
 	}
+	if id, err := result.LastInsertId(); nil == err {
+		log.Println("saved score", id)
+	}
 }
 
 func (s *DefaultScorer) Load(c *game.Chart) []History {
 	histories := []History{}
-	rows, err := s.db.Query("select sum, rate, inputs from scores where sum = ?", s.hashChart(c))
+	canonical, legacy := s.Hash(c), s.legacyHashChart(c)
+	// Scores from before the canonical hash are keyed by their alias, and
+	// scores from before judges were stored were played with judge 4
+	rows, err := s.db.Query(
+		"select id, sum, rate, inputs, coalesce(judge, 'J4'), coalesce(failed, 0), coalesce(pauses, 0) from scores where sum = ? or (sum = alias and alias = ?)",
+		canonical, legacy,
+	)
 	if nil != err && err != sql.ErrNoRows {
 		log.Println("unable to load scores", err)
 		return histories
 	}
 	defer rows.Close()
+	rekey := false
 	for rows.Next() {
+		var id int64
 		var sum string
 		var notes []byte
 		var rate uint16
-		rows.Scan(&sum, &rate, &notes)
+		var judge string
+		var failed int64
+		var pauses int
+		rows.Scan(&id, &sum, &rate, &notes, &judge, &failed, &pauses)
+		rekey = rekey || sum != canonical
 		var ns []InputsCompact
 		err := json.Unmarshal(notes, &ns)
 		if nil != err {
@@ -119,11 +290,26 @@ func (s *DefaultScorer) Load(c *game.Chart) []History {
 		}
 		inputs := uncompactInputs(ns)
 		histories = append(histories, History{
+			ID:     id,
 			Sum:    sum,
 			Inputs: inputs,
 			Rate:   rate,
+			Judge:  judge,
+			Failed: time.Duration(failed),
+			Pauses: pauses,
 		})
 	}
+	rows.Close()
+
+	// The canonical hash is only known once the chart is parsed, so the
+	// scores still keyed by the legacy hash are moved to it when they are
+	// first found, and the alias is kept as their old key
+	if rekey {
+		_, err := s.db.Exec("update scores set sum = ? where sum = alias and alias = ?", canonical, legacy)
+		if nil != err {
+			log.Println("unable to rekey scores", err)
+		}
+	}
 	return histories
 }
 
@@ -154,86 +340,179 @@ func (s *DefaultScorer) ApplyHistoryToChart(ch *game.Chart, history *History) *g
 		MineCount:  ch.MineCount,
 		Difficulty: ch.Difficulty,
 	}
+	pressed := map[uint8]time.Duration{} // When each held column was pressed
 	for _, input := range *history.Inputs {
+		if !input.Release {
+			pressed[input.Index] = input.HitTime
+		} else if start, ok := pressed[input.Index]; ok {
+			s.HitMines(&chart, input.Index, start, input.HitTime, history.Rate)
+			delete(pressed, input.Index)
+		}
 		s.ApplyInputToChart(&chart, &input, history.Rate)
 	}
 	return &chart
 }
 
-// Binary search for closest note, game.Chart should be in order
-func (s *DefaultScorer) GetClosestNote(chart *game.Chart, input *game.Input, rate uint16) (note *game.Note, distance, abs time.Duration) {
-	targets := make([]*game.Note, 0, len(chart.Notes))
-
-	for _, note := range chart.Notes {
-		// Reasons this note is not a valid hit target
-		if note.HitTime != 0 || note.IsMine || note.Index != input.Index {
+// HitMines hits the mines in a column that was held down from time from
+// until time to, and returns the mines that were hit
+func (s *DefaultScorer) HitMines(chart *game.Chart, index uint8, from, to time.Duration, rate uint16) []*game.Note {
+	hit := []*game.Note{}
+	notes := chart.Column(index).Notes
+	first := sort.Search(len(notes), func(i int) bool {
+		return s.Distance(rate, notes[i].Time, from-config.MineWindow) >= 0
+	})
+	for _, note := range notes[first:] {
+		t := time.Duration(note.Time * 100 / time.Duration(rate))
+		if t > to+config.MineWindow {
+			break
+		}
+		if !note.IsMine() || note.HitTime != 0 {
 			continue
 		}
-		targets = append(targets, note)
+		note.HitTime = t
+		if note.HitTime < from {
+			note.HitTime = from
+		}
+		hit = append(hit, note)
 	}
+	return hit
+}
 
-	if len(targets) == 0 {
-		return
-	}
-	// TODO: Probably crashes if only one target
-
-	note, distance, abs = s.searchClosest(targets, input, rate, 0, len(targets)-1)
-	if abs < config.Judgements[len(config.Judgements)-2].Time {
-		note.HitTime = input.HitTime
-		return
-	} else {
-		return nil, 0, 0
+// isTarget is whether a note can be hit by an input in its column
+func isTarget(note *game.Note, input *game.Input) bool {
+	if note.HitTime != 0 || note.MissTime != 0 || !note.IsJudged() {
+		return false
 	}
+	// Lifts are only hit by releases, and everything else by presses
+	return (note.Kind == game.KindLift) == input.Release
 }
 
-func (s *DefaultScorer) searchClosest(targets []*game.Note, input *game.Input, rate uint16, start, end int) (note *game.Note, distance, absDistance time.Duration) {
-	mid := (start + end) / 2
-	// It is impossible to hit the exact time, so do not check for equality
+// GetClosestNote hits the closest note to the input in its column, if it is
+// in the hit window, or misses it when it is only in the miss window. The
+// column is binary searched from its first note that has not been hit, and
+// then only the notes in the window are checked.
+func (s *DefaultScorer) GetClosestNote(chart *game.Chart, input *game.Input, rate uint16) (note *game.Note, distance, abs time.Duration) {
+	notes := chart.Column(input.Index).Pending()
+	hit, window := s.preset().HitWindow(), s.preset().MissWindow()
+
+	// The first note at or after the input
+	next := sort.Search(len(notes), func(i int) bool {
+		return s.Distance(rate, notes[i].Time, input.HitTime) >= 0
+	})
+
+	abs = window
+	// Earlier notes win ties, so check them first
+	for i := next - 1; i >= 0; i-- {
+		d := s.Distance(rate, notes[i].Time, input.HitTime)
+		if -d >= abs {
+			break
+		}
+		if isTarget(notes[i], input) {
+			note, distance, abs = notes[i], d, -d
+			break
+		}
+	}
+	// Like osu!mania, a late press misses an earlier note that is too late
+	// to hit, rather than hitting the next note early
+	for i := next; i < len(notes) && (nil == note || abs < hit); i++ {
+		d := s.Distance(rate, notes[i].Time, input.HitTime)
+		if d >= abs {
+			break
+		}
+		if isTarget(notes[i], input) {
+			note, distance, abs = notes[i], d, d
+			break
+		}
+	}
 
-	// One option left
-	if start == end {
-		note = targets[start]
-		distance = s.Distance(rate, targets[start].Time, input.HitTime)
-		absDistance = abs(distance)
+	if nil == note {
+		return nil, 0, 0
+	}
+	if abs >= hit {
+		note.MissTime = input.HitTime
 		return
 	}
+	note.HitTime = input.HitTime
+	return
+}
 
-	// If only two options left
-	if start == end-1 {
-		note = targets[start]
-		distance = s.Distance(rate, targets[start].Time, input.HitTime)
-		absDistance = abs(distance)
-
-		endDistanceDir := s.Distance(rate, targets[end].Time, input.HitTime)
-		endDistance := abs(endDistanceDir)
+// JudgeHold judges a hit hold or roll by time now. It is NG once it has
+// been let go of, or not tapped, for longer than its window before its end,
+// and OK once it reaches its end.
+func (s *DefaultScorer) JudgeHold(note *game.Note, now time.Duration, rate uint16) game.HoldJudgement {
+	if note.TimeEnd == 0 || note.HitTime == 0 || note.Hold != game.HoldPending {
+		return note.Hold
+	}
+	// The hold only needs to be kept until its end
+	end := time.Duration(note.TimeEnd * 100 / time.Duration(rate))
+	until := now
+	if end < until {
+		until = end
+	}
 
-		if absDistance > endDistance {
-			note = targets[end]
-			distance = endDistanceDir
-			absDistance = endDistance
-			return
+	last, window := until, config.HoldWindow
+	if note.Kind == game.KindRoll {
+		last, window = note.HitTime, config.RollWindow
+		if note.RollTime > last {
+			last = note.RollTime
 		}
-		return
+	} else if note.ReleaseTime != 0 {
+		last = note.ReleaseTime
+	}
 
+	if until-last > window {
+		note.DropTime = last + window
+		note.Hold = game.HoldNG
+	} else if now >= end {
+		note.Hold = game.HoldOK
 	}
+	return note.Hold
+}
 
-	midDistance := s.Distance(rate, targets[mid].Time, input.HitTime)
-	// Hit early
-	if midDistance > 0 {
-		return s.searchClosest(targets, input, rate, start, mid)
-	} else {
-		return s.searchClosest(targets, input, rate, mid, end)
+// grabHold keeps a hold or roll in the input column alive, and returns the
+// note if the input was used for it. Presses tap rolls and grab holds that
+// were let go of, and releases let go of holds.
+func (s *DefaultScorer) grabHold(chart *game.Chart, input *game.Input, rate uint16) *game.Note {
+	for _, note := range chart.Column(input.Index).Holds {
+		if note.HitTime == 0 {
+			continue
+		}
+		// Only notes that are scrolling past the hit bar
+		if s.Distance(rate, note.Time, input.HitTime) > 0 || s.Distance(rate, note.TimeEnd, input.HitTime) < 0 {
+			continue
+		}
+		if s.JudgeHold(note, input.HitTime, rate) != game.HoldPending {
+			continue
+		}
+		switch {
+		case note.Kind == game.KindRoll && !input.Release:
+			note.RollTime = input.HitTime
+		case note.Kind == game.KindHold && input.Release && note.ReleaseTime == 0:
+			note.ReleaseTime = input.HitTime
+		case note.Kind == game.KindHold && !input.Release && note.ReleaseTime != 0:
+			note.ReleaseTime = 0
+		default:
+			continue
+		}
+		return note
 	}
+	return nil
 }
 
 func (s *DefaultScorer) ApplyInputToChart(chart *game.Chart, input *game.Input, rate uint16) (note *game.Note, distance, absDistance time.Duration) {
+	if !input.Release {
+		s.HitMines(chart, input.Index, input.HitTime, input.HitTime, rate)
+	}
+	if nil != s.grabHold(chart, input, rate) {
+		return nil, 0, 0
+	}
 	return s.GetClosestNote(chart, input, rate)
 	/*var closestNote *game.Note
 	absDistance := time.Hour * 24
 	distance := time.Hour * 24
 
 	for _, note := range chart.Notes {
-		if note.HitTime != 0 || note.IsMine {
+		if note.HitTime != 0 || note.IsMine() {
 			continue
 		}
 		if note.Index != input.Index {
@@ -251,23 +530,62 @@ func (s *DefaultScorer) ApplyInputToChart(chart *game.Chart, input *game.Input,
 		}
 	}
 
-	if nil != closestNote && absDistance < config.Judgements[len(config.Judgements)-2].Time {
+	if nil != closestNote && absDistance < s.preset().HitWindow() {
 		closestNote.HitTime = input.HitTime
 		onHit(closestNote, distance, absDistance)
 	}*/
 }
 
+// Score judges a history under its Judge preset, so changing the preset of
+// a stored history re-judges it
 func (s *DefaultScorer) Score(chart *game.Chart, history *History) Score {
-	var score Score
-	ch := s.ApplyHistoryToChart(chart, history)
+	judged := s
+	if history.Judge != "" {
+		preset, err := config.JudgePresetFor(history.Judge)
+		if nil != err {
+			log.Println("unable to re-judge score", err)
+		} else {
+			judged = &DefaultScorer{db: s.db, judge: preset}
+		}
+	}
+	preset := judged.preset()
+
+	score := Score{
+		Judge:  preset.Name,
+		Counts: make([]uint64, len(preset.Judgements)),
+		Failed: history.Failed,
+		Pauses: history.Pauses,
+	}
+	var points float64
+	notes := 0
+	ch := judged.ApplyHistoryToChart(chart, history)
 	for _, n := range ch.Notes {
+		if n.IsMine() && n.HitTime != 0 {
+			score.MineHits++
+			points += WifeMineHitWeight
+		}
+		if !n.IsJudged() {
+			continue
+		}
+		notes++
 		if n.HitTime == 0 {
-			if !n.IsMine {
-				score.MissCount++
-			}
+			score.MissCount++
+			score.Counts[len(score.Counts)-1]++
+			points += WifeMissWeight
 			continue
 		}
-		score.TotalError += abs(s.Distance(history.Rate, n.Time, n.HitTime))
+		distance := s.Distance(history.Rate, n.Time, n.HitTime)
+		score.TotalError += abs(distance)
+		score.Counts[preset.Index(abs(distance))]++
+		points += WifePoints(distance, preset.Scale)
+		switch judged.JudgeHold(n, n.TimeEnd*100/time.Duration(history.Rate), history.Rate) {
+		case game.HoldOK:
+			score.OKCount++
+		case game.HoldNG:
+			score.NGCount++
+			points += WifeHoldDropWeight
+		}
 	}
+	score.Wife = WifePercent(points, notes)
 	return score
 }
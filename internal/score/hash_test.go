@@ -0,0 +1,188 @@
+package score
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/parser"
+)
+
+const smChart = `#TITLE:Hash;
+#OFFSET:0.000;
+#BPMS:0.000=120.000,4.000=240.000;
+#STOPS:2.000=0.500;
+#NOTES:
+     dance-single:
+     :
+     Hard:
+     8:
+     0,0,0,0,0:
+1000
+0100
+0010
+0001
+,
+2000
+0000
+3000
+0000
+;
+`
+
+// The same chart as smChart, written by another editor
+const sscHashChart = `#VERSION:0.83;
+#TITLE:Hash;
+#OFFSET:0;
+#BPMS:0=120,4=240;
+#STOPS:2=0.5;
+#NOTEDATA:;
+#STEPSTYPE:dance-single;
+#DIFFICULTY:Hard;
+#METER:8;
+#NOTES:
+1000
+0100
+0010
+0001
+,  // measure 2
+2000
+0000
+3000
+0000
+;
+`
+
+func parseHashChart(t *testing.T, p parser.Parser, name, data string) *game.Chart {
+	dir, err := ioutil.TempDir("", "eotw")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(data), 0644); nil != err {
+		t.Fatal(err)
+	}
+	charts, err := p.Parse(file)
+	if nil != err || len(charts) != 1 {
+		t.Fatal("unable to parse chart", err)
+	}
+	return charts[0]
+}
+
+func TestHashChart(t *testing.T) {
+	scorer := DefaultScorer{}
+	sm := parseHashChart(t, &parser.DefaultParser{}, "hash.sm", smChart)
+	crlf := parseHashChart(t, &parser.DefaultParser{}, "hash.sm", strings.ReplaceAll(smChart, "\n", "\r\n"))
+	ssc := parseHashChart(t, &parser.SSCParser{}, "hash.ssc", sscHashChart)
+	moved := parseHashChart(t, &parser.DefaultParser{}, "hash.sm", strings.Replace(smChart, "0001", "0010", 1))
+
+	expected := scorer.Hash(sm)
+	for name, chart := range map[string]*game.Chart{"crlf": crlf, "ssc": ssc} {
+		if sum := scorer.Hash(chart); sum != expected {
+			t.Log("Chart   ", name)
+			t.Log("Sum     ", sum)
+			t.Log("Expected", expected)
+			t.Fail()
+		}
+	}
+	if scorer.Hash(moved) == expected {
+		t.Log("Moving a note did not change the hash")
+		t.Fail()
+	}
+}
+
+func TestLoadLegacyScores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eotw")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	// Save a score the way that older versions did
+	scorer := DefaultScorer{}
+	chart := parseHashChart(t, &parser.DefaultParser{}, "hash.sm", smChart)
+	db, err := sql.Open("sqlite3", "./scores.db")
+	if nil != err {
+		t.Fatal(err)
+	}
+	db.Exec("create table scores (id integer not null primary key, sum text, rate integer, inputs bytearray)")
+	db.Exec("insert into scores(sum, rate, inputs) values(?, 100, '[]')", scorer.legacyHashChart(chart))
+	db.Close()
+
+	if err := scorer.Init(); nil != err {
+		t.Fatal(err)
+	}
+	defer scorer.Deinit()
+
+	// The score is found by the legacy hash the first time, and is then
+	// keyed by the canonical hash, with the legacy hash as its alias
+	for _, expected := range []string{scorer.legacyHashChart(chart), scorer.Hash(chart)} {
+		histories := scorer.Load(chart)
+		if len(histories) != 1 || histories[0].Sum != expected {
+			t.Log("Histories", histories)
+			t.Log("Expected ", expected)
+			t.Fail()
+		}
+	}
+	var sum, alias string
+	scorer.db.QueryRow("select sum, alias from scores").Scan(&sum, &alias)
+	if sum != scorer.Hash(chart) || alias != scorer.legacyHashChart(chart) {
+		t.Log("Sum  ", sum)
+		t.Log("Alias", alias)
+		t.Fail()
+	}
+}
+
+func TestSaveAndLoadReleases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eotw")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	scorer := DefaultScorer{}
+	if err := scorer.Init(); nil != err {
+		t.Fatal(err)
+	}
+	defer scorer.Deinit()
+
+	chart := parseHashChart(t, &parser.DefaultParser{}, "hash.sm", smChart)
+	inputs := []game.Input{
+		{Index: 0, HitTime: 100},
+		{Index: 0, HitTime: 200, Release: true},
+		{Index: 2, HitTime: 150},
+	}
+	scorer.Save(chart, &History{Inputs: &inputs, Rate: 100, Failed: 3 * time.Second, Pauses: 2})
+
+	histories := scorer.Load(chart)
+	if len(histories) != 1 {
+		t.Fatal("expected 1 history, got", len(histories))
+	}
+	if histories[0].Failed != 3*time.Second || histories[0].Pauses != 2 {
+		t.Log("Expected the run to have failed at 3s after 2 pauses, got", histories[0].Failed, histories[0].Pauses)
+		t.Fail()
+	}
+	loaded := *histories[0].Inputs
+	if len(loaded) != len(inputs) {
+		t.Fatal("expected", inputs, "got", loaded)
+	}
+	for i := range inputs {
+		if loaded[i] != inputs[i] {
+			t.Log("Loaded  ", loaded)
+			t.Log("Expected", inputs)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package score
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+func judgeChart() *game.Chart {
+	return &game.Chart{
+		Notes: []*game.Note{
+			{Index: 0, Time: time.Second},
+			{Index: 1, Time: 2 * time.Second},
+		},
+	}
+}
+
+// The judgement counts of a hit 40ms and a hit 100ms from their notes
+var rejudgeTests = map[string][]uint64{
+	"J4":   {0, 0, 1, 0, 1, 0, 0},
+	"J7":   {0, 0, 0, 1, 0, 0, 1},
+	"J9":   {0, 0, 0, 0, 0, 0, 2},
+	"OD8":  {0, 0, 1, 1, 0, 0},
+	"OD10": {0, 0, 1, 0, 1, 0},
+}
+
+func TestRejudge(t *testing.T) {
+	scorer := DefaultScorer{}
+	inputs := []game.Input{
+		{Index: 0, HitTime: time.Second + 40*time.Millisecond},
+		{Index: 1, HitTime: 2*time.Second + 100*time.Millisecond},
+	}
+	for judge, expected := range rejudgeTests {
+		score := scorer.Score(judgeChart(), &History{Inputs: &inputs, Rate: 100, Judge: judge})
+		if score.Judge != judge || score.MissCount != expected[len(expected)-1] || fmt.Sprint(score.Counts) != fmt.Sprint(expected) {
+			t.Log("Judge   ", judge)
+			t.Log("Score   ", score)
+			t.Log("Expected", expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestODMissWindow(t *testing.T) {
+	chart := &game.Chart{
+		Notes: []*game.Note{
+			{Index: 0, Time: time.Second},
+			{Index: 0, Time: 1300 * time.Millisecond},
+		},
+	}
+	// Under OD0 a 50 is within 151ms and a miss within 188ms, so the press
+	// is too late for the first note, but still takes it as a miss rather
+	// than hitting the second note early
+	inputs := []game.Input{{Index: 0, HitTime: 1170 * time.Millisecond}}
+	scorer := DefaultScorer{}
+	score := scorer.Score(chart, &History{Inputs: &inputs, Rate: 100, Judge: "OD0"})
+	if score.MissCount != 2 || fmt.Sprint(score.Counts) != "[0 0 0 0 0 2]" {
+		t.Log("Score", score)
+		t.Fail()
+	}
+}
@@ -0,0 +1,117 @@
+package score
+
+import (
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+func kindChart() *game.Chart {
+	return &game.Chart{
+		Notes: []*game.Note{
+			{Index: 0, Kind: game.KindFake, Time: time.Second},
+			{Index: 0, Kind: game.KindTap, Time: time.Second},
+			{Index: 1, Kind: game.KindLift, Time: time.Second},
+			{Index: 2, Kind: game.KindRoll, Time: time.Second, TimeEnd: 3 * time.Second},
+		},
+	}
+}
+
+// The kind of note that each input hits, with -1 for no note
+var kindTests = map[game.Input]int{
+	{Index: 0, HitTime: time.Second}:                int(game.KindTap),
+	{Index: 1, HitTime: time.Second}:                -1,
+	{Index: 1, HitTime: time.Second, Release: true}: int(game.KindLift),
+	{Index: 2, HitTime: time.Second}:                int(game.KindRoll),
+	{Index: 2, HitTime: time.Second, Release: true}: -1,
+}
+
+func TestApplyInputToKinds(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+
+	scorer := DefaultScorer{}
+	for input, expected := range kindTests {
+		input := input
+		note, _, _ := scorer.ApplyInputToChart(kindChart(), &input, 100)
+		kind := -1
+		if nil != note {
+			kind = int(note.Kind)
+		}
+		if kind != expected {
+			t.Log("Input   ", input)
+			t.Log("Note    ", note)
+			t.Log("Expected", expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestJudgeRoll(t *testing.T) {
+	config.RollWindow = 300 * time.Millisecond
+
+	scorer := DefaultScorer{}
+	chart := kindChart()
+	roll := chart.Notes[3]
+	roll.HitTime = time.Second
+
+	// Tapping within the window keeps the roll alive
+	taps := []time.Duration{1200 * time.Millisecond, 1450 * time.Millisecond, 1700 * time.Millisecond}
+	for _, tap := range taps {
+		input := game.Input{Index: 2, HitTime: tap}
+		if note, _, _ := scorer.ApplyInputToChart(chart, &input, 100); nil != note {
+			t.Log("Roll tap judged as", note)
+			t.Fail()
+		}
+	}
+	if scorer.JudgeHold(roll, 1900*time.Millisecond, 100) != game.HoldPending {
+		t.Log("Roll dropped while being tapped", roll)
+		t.Fail()
+	}
+	if scorer.JudgeHold(roll, 2100*time.Millisecond, 100) != game.HoldNG || roll.DropTime != 2000*time.Millisecond {
+		t.Log("Roll not dropped after the window", roll)
+		t.Fail()
+	}
+}
+
+// The hold judgement of a hold from 1s to 3s, given the inputs after its
+// head is hit
+var holdTests = []struct {
+	inputs   []game.Input
+	expected game.HoldJudgement
+}{
+	{inputs: []game.Input{}, expected: game.HoldOK},
+	{inputs: []game.Input{{HitTime: 2 * time.Second, Release: true}}, expected: game.HoldNG},
+	{inputs: []game.Input{{HitTime: 2900 * time.Millisecond, Release: true}}, expected: game.HoldOK},
+	{inputs: []game.Input{
+		{HitTime: 2 * time.Second, Release: true},
+		{HitTime: 2100 * time.Millisecond},
+	}, expected: game.HoldOK},
+	{inputs: []game.Input{
+		{HitTime: 2 * time.Second, Release: true},
+		{HitTime: 2400 * time.Millisecond},
+	}, expected: game.HoldNG},
+}
+
+func TestJudgeHold(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+	config.HoldWindow = 250 * time.Millisecond
+
+	scorer := DefaultScorer{}
+	for _, test := range holdTests {
+		chart := &game.Chart{Notes: []*game.Note{
+			{Index: 0, Kind: game.KindHold, Time: time.Second, TimeEnd: 3 * time.Second},
+		}}
+		inputs := append([]game.Input{{HitTime: time.Second}}, test.inputs...)
+		for _, input := range inputs {
+			scorer.ApplyInputToChart(chart, &input, 100)
+		}
+		if judgement := scorer.JudgeHold(chart.Notes[0], 4*time.Second, 100); judgement != test.expected {
+			t.Log("Inputs  ", inputs)
+			t.Log("Hold    ", chart.Notes[0])
+			t.Log("Expected", test.expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package score
+
+import (
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+// The mine hits of the inputs on a chart with a mine at 1s in column 0
+var mineTests = []struct {
+	inputs   []game.Input
+	expected uint64
+}{
+	{inputs: []game.Input{}, expected: 0},
+	{inputs: []game.Input{{HitTime: 950 * time.Millisecond}}, expected: 1},
+	{inputs: []game.Input{{HitTime: 1050 * time.Millisecond}}, expected: 1},
+	{inputs: []game.Input{{HitTime: 800 * time.Millisecond}}, expected: 0},
+	{inputs: []game.Input{{Index: 1, HitTime: time.Second}}, expected: 0},
+	{inputs: []game.Input{
+		{HitTime: 500 * time.Millisecond},
+		{HitTime: 1500 * time.Millisecond, Release: true},
+	}, expected: 1},
+	{inputs: []game.Input{
+		{HitTime: 500 * time.Millisecond},
+		{HitTime: 600 * time.Millisecond, Release: true},
+	}, expected: 0},
+}
+
+func TestMineHits(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+	config.MineWindow = 75 * time.Millisecond
+
+	scorer := DefaultScorer{}
+	for _, test := range mineTests {
+		chart := &game.Chart{Notes: []*game.Note{
+			{Index: 0, Kind: game.KindMine, Time: time.Second},
+			{Index: 1, Time: 2 * time.Second},
+		}}
+		inputs := test.inputs
+		score := scorer.Score(chart, &History{Inputs: &inputs, Rate: 100})
+		if score.MineHits != test.expected {
+			t.Log("Inputs  ", inputs)
+			t.Log("Score   ", score)
+			t.Log("Expected", test.expected)
+			t.Fail()
+		}
+	}
+}
@@ -10,8 +10,8 @@ type Scorer interface {
 	Init() error
 	Deinit()
 
-	// Save the state of this performance
-	Save(chart *game.Chart, inputs *[]game.Input, rate uint16)
+	// Save the inputs, rate, fail time and pauses of this performance
+	Save(chart *game.Chart, history *History)
 
 	// Load up previous state for the chart
 	Load(chart *game.Chart) []History
@@ -19,16 +19,34 @@ type Scorer interface {
 	Score(chart *game.Chart, history *History) Score
 	ApplyInputToChart(chart *game.Chart, input *game.Input, rate uint16) (note *game.Note, distance, absDistance time.Duration)
 
+	// Hit the mines in a column that was held down between from and to
+	HitMines(chart *game.Chart, index uint8, from, to time.Duration, rate uint16) []*game.Note
+
+	// Judge a hit hold or roll as OK or NG once it is known by time now
+	JudgeHold(note *game.Note, now time.Duration, rate uint16) game.HoldJudgement
+
 	Distance(rate uint16, expected, actual time.Duration) time.Duration
 }
 
 type History struct {
+	ID     int64
 	Sum    string
 	Inputs *[]game.Input
 	Rate   uint16
+	Judge  string        // Name of the judge preset
+	Failed time.Duration // When the run failed, or 0 if it did not
+	Pauses int           // How many times the run was paused
 }
 
 type Score struct {
 	MissCount  uint64
+	OKCount    uint64 // Holds and rolls that were kept until their end
+	NGCount    uint64 // Holds and rolls that were dropped
+	MineHits   uint64
 	TotalError time.Duration
+	Wife       float64  // Wife3 accuracy, as a percentage
+	Judge      string   // Name of the judge preset that this was judged with
+	Counts     []uint64 // Notes in each judgement of the preset, with misses last
+	Failed     time.Duration
+	Pauses     int // Paused runs are not ranked
 }
@@ -0,0 +1,52 @@
+package score
+
+import (
+	"math"
+	"time"
+)
+
+// Wife3 weights, which are the same as those of Etterna so that
+// percentages can be compared with it
+const (
+	WifeMaxPoints      = 2.0
+	WifeMissWeight     = -5.5
+	WifeMineHitWeight  = -7.0
+	WifeHoldDropWeight = -4.5
+)
+
+// wife3 is the points for a hit ms away from the note at timing scale ts,
+// where a ts of 1 is judge 4
+func wife3(ms, ts float64) float64 {
+	ms = math.Abs(ms)
+	ridic := 5 * ts
+	maxBooWeight := 180 * ts
+	if ms <= ridic {
+		return WifeMaxPoints
+	}
+
+	// Scale less than linearly so that higher judges are not so extreme
+	zero := 65 * math.Pow(ts, 0.75)
+	dev := 22.7 * math.Pow(ts, 0.75)
+	if ms <= zero {
+		return WifeMaxPoints * math.Erf((zero-ms)/dev)
+	}
+	if ms <= maxBooWeight {
+		return (ms - zero) * WifeMissWeight / (maxBooWeight - zero)
+	}
+	return WifeMissWeight
+}
+
+// WifePoints is the Wife3 points for a hit that is distance from its note,
+// at the timing scale of a judge preset
+func WifePoints(distance time.Duration, scale float64) float64 {
+	return wife3(float64(distance)/float64(time.Millisecond), scale)
+}
+
+// WifePercent is points as a percentage of the most that could be gained
+// from the number of judged notes
+func WifePercent(points float64, notes int) float64 {
+	if notes == 0 {
+		return 0
+	}
+	return 100 * points / (WifeMaxPoints * float64(notes))
+}
@@ -0,0 +1,52 @@
+package score
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+)
+
+var wifeTests = map[time.Duration]float64{
+	0:                       2,
+	-5 * time.Millisecond:   2,
+	30 * time.Millisecond:   1.9415599757312298,
+	-65 * time.Millisecond:  0,
+	100 * time.Millisecond:  -1.673913043478261,
+	180 * time.Millisecond:  -5.5,
+	-400 * time.Millisecond: -5.5,
+}
+
+func TestWifePoints(t *testing.T) {
+	for distance, expected := range wifeTests {
+		if points := WifePoints(distance, 1); math.Abs(points-expected) > 1e-9 {
+			t.Log("Distance", distance)
+			t.Log("Points  ", points)
+			t.Log("Expected", expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestScoreWife(t *testing.T) {
+	config.Judgements = []game.Judgement{{Time: 180 * time.Millisecond}, {}}
+
+	scorer := DefaultScorer{}
+	chart := &game.Chart{
+		Notes: []*game.Note{
+			{Index: 0, Time: time.Second},
+			{Index: 1, Time: time.Second},
+			{Index: 2, Kind: game.KindFake, Time: time.Second},
+		},
+	}
+	// One perfect hit and one miss, with the fake not counted
+	inputs := []game.Input{{Index: 0, HitTime: time.Second}}
+	score := scorer.Score(chart, &History{Inputs: &inputs, Rate: 100})
+	if expected := 100 * (2 - 5.5) / 4; score.Wife != expected || score.MissCount != 1 {
+		t.Log("Score   ", score)
+		t.Log("Expected", expected)
+		t.Fail()
+	}
+}
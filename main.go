@@ -1,20 +1,106 @@
 package main
 
 import (
+	"errors"
 	"log"
-	"time"
+	"os"
+	"path/filepath"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 
+	"git.lost.host/meutraa/eotw/internal/autoplay"
 	"git.lost.host/meutraa/eotw/internal/config"
-	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/library"
+	"git.lost.host/meutraa/eotw/internal/score"
 )
 
 func main() {
 	config.Init()
-	if err := run(); nil != err {
+
+	program := Program{}
+	if !library.IsSong(*config.Directory) {
+		if err := browse(&program); nil != err {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if err := program.Load(); nil != err {
+		log.Fatalln(err)
+	}
+	if *config.List {
+		program.ListCharts(os.Stdout)
+		return
+	}
+	if config.Simulate && 0 == *config.Replay {
+		// Simulations are not saved, so they need no scores
+		program.Scorer = &score.DefaultScorer{}
+	} else if err := program.InitScorer(); nil != err {
+		log.Fatalln(err)
+	}
+	defer program.Scorer.Deinit()
+
+	var err error
+	if 0 != *config.Replay {
+		err = program.SelectReplay(*config.Replay)
+	} else {
+		err = program.Select(*config.Difficulty, *config.Meter)
+	}
+	if nil != err {
 		log.Fatalln(err)
 	}
+	if *config.Autoplay {
+		program.Autoplay(newBot())
+	}
+
+	if config.Simulate {
+		err = simulate(&program, os.Stdout)
+	} else {
+		err = run(&program, nil)
+	}
+	if nil != err {
+		log.Fatalln(err)
+	}
+}
+
+// browse lists the songs of the packs in the songs directory, from the
+// library in the scores database, to choose charts to play from
+func browse(program *Program) error {
+	if config.Simulate || 0 != *config.Replay {
+		return errors.New("simulate and --replay need a song directory")
+	}
+	scorer := &score.DefaultScorer{}
+	if err := scorer.Init(); nil != err {
+		return err
+	}
+	defer scorer.Deinit()
+	program.Scorer = scorer
+
+	cache := library.NewCache(scorer.DB(), scorer.Hash)
+	packs, err := cache.Scan(*config.Directory, *config.Rescan)
+	if nil != err {
+		return err
+	}
+	if *config.List {
+		for _, pack := range packs {
+			for _, song := range pack.Songs {
+				listCharts(os.Stdout, filepath.Join(pack.Name, filepath.Base(song.Directory))+"\t", song.Charts)
+			}
+		}
+		return nil
+	}
+	songs := NewSongSelect(packs)
+	songs.Search = func(query string) ([]*library.Pack, error) {
+		return cache.Packs(*config.Directory, query)
+	}
+	return run(program, songs)
+}
+
+func newBot() *autoplay.Bot {
+	bot := autoplay.NewBot()
+	bot.Mean = *config.AutoplayMean
+	bot.Stdev = *config.AutoplayStdev
+	bot.Releases = *config.AutoplayReleases
+	return bot
 }
 
 func getColumn(nKeys uint8, mc int32, index uint8) int32 {
@@ -27,17 +113,7 @@ func getColumn(nKeys uint8, mc int32, index uint8) int32 {
 	}
 }
 
-func judge(d time.Duration) (int, *game.Judgement) {
-	for i, j := range config.Judgements {
-		if d < j.Time {
-			return i, &j
-		}
-	}
-	// This should never happen, since a check for d < missDistance is made
-	return -1, nil
-}
-
-func run() error {
+func run(program *Program, songs *SongSelect) error {
 	flags := rl.FlagVsyncHint | rl.FlagMsaa4xHint | rl.FlagWindowResizable
 	rl.SetConfigFlags(byte(flags))
 
@@ -49,7 +125,6 @@ func run() error {
 
 	rl.SetTargetFPS(int32(*config.RefreshRate))
 
-	program := Program{}
 	if err := program.Init(); nil != err {
 		return err
 	}
@@ -59,36 +134,27 @@ func run() error {
 	rl.SetTextureFilter(tex, rl.FilterAnisotropic16x)
 	rl.SetShapesTexture(tex, rl.Rectangle{Width: 20, Height: 20})
 
-	music := rl.LoadMusicStream(program.audioFile)
-	music.Looping = false
-	defer rl.UnloadMusicStream(music)
-	program.music = &music
-	program.musicLength = rl.GetMusicTimeLength(music)
-
-	rl.SetMusicPitch(music, float32(*config.Rate)/100)
-
-	go func() {
-		time.Sleep(*config.Delay + *config.Offset)
-		rl.PlayMusicStream(music)
-	}()
-
-	program.startTime = time.Now().Add(*config.Delay)
+	if nil == songs {
+		program.Play()
+		return nil
+	}
 
-	for !rl.WindowShouldClose() {
-		rl.UpdateMusicStream(music)
-		if rl.IsWindowResized() {
-			program.Resize()
+	// Escape leaves a chart for the song list, and then closes the window
+	rl.SetExitKey(0)
+	defer songs.Close()
+	for {
+		song, chart := songs.Choose(program.Font)
+		if nil == chart {
+			return nil
 		}
-
-		duration := time.Since(program.startTime)
-		program.Update(duration)
-		program.Render(duration)
-
-		if rl.GetMusicTimePlayed(music) >= program.musicLength {
-			break
+		if err := song.Parse(); nil != err {
+			log.Println("unable to load song", song.Directory, err)
+			continue
 		}
+		program.choose(song, chart)
+		if *config.Autoplay {
+			program.Autoplay(newBot())
+		}
+		program.Play()
 	}
-
-	program.Scorer.Save(&program.chart, &program.inputs, *config.Rate)
-	return nil
 }
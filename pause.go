@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/play"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// newSession starts playing the chart from the start, with the replay or
+// the keyboard
+func (p *Program) newSession() {
+	input := p.input
+	if nil != p.replay {
+		input = play.NewReplay(p.replay)
+	}
+	p.clock = play.NewAudioClock(&p.wall, p.musicPosition)
+	p.session = play.NewSession(&p.chart, p.Scorer, p.clock, input, *config.Rate)
+}
+
+// Time is the time in the chart that is shown, which is held while paused,
+// and scrolls through the lead-in to the pause while counting down. Only
+// the chart is rewound, as the music stays paused, and keys are not played
+// until it plays on.
+func (p *Program) Time() time.Duration {
+	if !p.paused {
+		return p.session.Time()
+	}
+	if p.resumeAt.IsZero() {
+		return p.pausedAt
+	}
+	return p.pausedAt - time.Until(p.resumeAt)
+}
+
+// Pause stops the music and the chart where they are
+func (p *Program) Pause() {
+	if p.paused || p.session.Done() {
+		return
+	}
+	p.paused = true
+	p.pausedAt = p.session.Time()
+	p.pauseStart = time.Now()
+	p.resumeAt = time.Time{}
+	p.pauses++
+	if nil != p.music {
+		rl.PauseMusicStream(*p.music)
+	}
+}
+
+// Resume counts down through the lead-in to where the chart was paused, and
+// then plays on from there
+func (p *Program) Resume() {
+	if !p.paused || !p.resumeAt.IsZero() {
+		return
+	}
+	p.resumeAt = time.Now().Add(*config.LeadIn)
+}
+
+// play plays on from the pause
+func (p *Program) play() {
+	// The clock carries on from where it was paused
+	p.wall.Start = p.wall.Start.Add(time.Since(p.pauseStart))
+	p.paused = false
+	p.resumeAt = time.Time{}
+	if p.musicStarted {
+		rl.ResumeMusicStream(*p.music)
+	}
+}
+
+// Restart plays the chart again from the start, forgetting the run so far
+func (p *Program) Restart() {
+	if nil != p.music {
+		rl.StopMusicStream(*p.music)
+	}
+	p.reset()
+}
+
+// reset readies the chart to be played from the start
+func (p *Program) reset() {
+	p.musicStarted = false
+	p.paused = false
+	p.resumeAt = time.Time{}
+	p.pauses = 0
+	p.decorations = nil
+
+	// Keys pressed before the restart are not played
+	if nil == p.replay {
+		p.input.Poll(math.MaxInt64)
+	}
+	p.chart.Reset()
+	p.newSession()
+	p.wall.Start = time.Now().Add(*config.Delay)
+}
+
+// RenderPause draws the pause over the chart, with the countdown to when
+// it plays on
+func (p *Program) RenderPause() {
+	rl.DrawRectangle(0, 0, p.width, p.height, rl.NewColor(0, 0, 0, 160))
+
+	text := "Paused"
+	if !p.resumeAt.IsZero() {
+		text = fmt.Sprintf("%v", math.Ceil(time.Until(p.resumeAt).Seconds()))
+	}
+	size := float32(*config.FontSize) * 2
+	width := rl.MeasureTextEx(p.Font, text, size, 1).X
+	rl.DrawTextEx(p.Font, text, rl.Vector2{X: float32(p.middle.X) - width/2, Y: float32(p.middle.Y)}, size, 1, rl.White)
+}
@@ -1,19 +1,19 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math"
-	"os"
-	"path"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"git.lost.host/meutraa/eotw/internal/autoplay"
 	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/evdev"
 	"git.lost.host/meutraa/eotw/internal/game"
-	"git.lost.host/meutraa/eotw/internal/parser"
+	"git.lost.host/meutraa/eotw/internal/library"
+	"git.lost.host/meutraa/eotw/internal/play"
 	"git.lost.host/meutraa/eotw/internal/score"
 	"git.lost.host/meutraa/eotw/internal/theme"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -33,12 +33,13 @@ type Decoration struct {
 }
 
 type Program struct {
-	Parser *parser.DefaultParser
 	Scorer *score.DefaultScorer
 	Theme  *theme.DefaultTheme
 	Font   rl.Font
 
-	startTime time.Time
+	wall    play.WallClock
+	clock   *play.AudioClock
+	session *play.Session
 
 	frameCounter  uint64
 	width, height int32
@@ -47,21 +48,29 @@ type Program struct {
 
 	decorations []*Decoration
 
-	audioFile, chartFile string
-	music                *rl.Music
-	musicLength          float32 // In seconds
+	song        *library.Song
+	audioFile   string    // Empty for keysounded charts, which have no music
+	music       *rl.Music // Nil when there is no music
+	musicLength float32   // In seconds
 
 	charts []*game.Chart
 	chart  game.Chart
 
 	sideCol int32
 
-	// Stats for current chart
-	distanceError, sumOfDistance time.Duration
-	counts                       []int
-	mean, stdev                  float64
-	totalHits                    uint64
-	inputs                       []game.Input
+	// The inputs of a replay or the bot, or nil to play with the keyboard
+	replay []game.Input
+	input  play.InputSource
+
+	musicStarted bool
+
+	// While paused, the chart is stopped at pausedAt, and it plays on at
+	// resumeAt, once resume has been pressed
+	paused     bool
+	pausedAt   time.Duration
+	pauseStart time.Time
+	resumeAt   time.Time
+	pauses     int
 }
 
 func (p *Program) Resize() {
@@ -76,147 +85,378 @@ func (p *Program) Resize() {
 	}
 }
 
+// Load parses the charts and finds the audio in the song directory, which
+// does not need a window
+func (g *Program) Load() error {
+	song, err := library.Load(*config.Directory)
+	if nil != err {
+		return err
+	}
+	g.song = song
+	g.charts = song.Charts
+	return nil
+}
+
+// InitScorer opens the scores of every chart
+func (g *Program) InitScorer() error {
+	g.Scorer = &score.DefaultScorer{}
+	return g.Scorer.Init()
+}
+
+// SelectReplay picks the chart of the score with id to be watched, and
+// plays it at the rate and judge that it was played with
+func (g *Program) SelectReplay(id int64) error {
+	for _, chart := range g.charts {
+		for _, history := range g.Scorer.Load(chart) {
+			if history.ID != id {
+				continue
+			}
+			if err := config.SetJudge(history.Judge); nil != err {
+				return err
+			}
+			*config.Rate = history.Rate
+
+			g.replay = *history.Inputs
+			g.choose(g.song, chart)
+			return nil
+		}
+	}
+	return fmt.Errorf("no score %v for the charts in the directory", id)
+}
+
+// Autoplay lets bot play the selected chart, as if it were a replay
+func (g *Program) Autoplay(bot *autoplay.Bot) {
+	g.replay = bot.Inputs(&g.chart, *config.Rate)
+}
+
+// Select picks the chart to play and its music
+func (g *Program) Select(difficulty, meter string) error {
+	chart, err := selectChart(g.charts, difficulty, meter)
+	if nil != err {
+		return err
+	}
+	g.choose(g.song, chart)
+	return nil
+}
+
 func (g *Program) Init() error {
 	// Ensure our Default implementations are used as interfaces
-	g.Parser = &parser.DefaultParser{}
-	g.Scorer = &score.DefaultScorer{}
 	g.Theme = &theme.DefaultTheme{}
 	g.Font = rl.LoadFontEx("assets/fonts/Inconsolata-Regular.ttf", *config.FontSize, nil, 0)
 
-	if err := filepath.Walk(*config.Directory, func(p string, info os.FileInfo, err error) error {
-		switch path.Ext(info.Name()) {
-		case ".ogg", ".mp3", ".xm", ".mod", ".wav":
-			g.audioFile = p
-		case ".sm":
-			g.chartFile = p
+	if nil == g.replay {
+		g.input = g.keyboardInput()
+	}
+
+	g.Resize()
+
+	return nil
+}
+
+// Play plays the chosen chart until it ends, fails or is left, and then
+// saves the score, unless it was left
+func (p *Program) Play() {
+	// Without music, the run follows the wall clock to the end of the chart
+	p.music = nil
+	if p.audioFile != "" {
+		music := rl.LoadMusicStream(p.audioFile)
+		music.Looping = false
+		defer rl.UnloadMusicStream(music)
+		p.music = &music
+		p.musicLength = rl.GetMusicTimeLength(music)
+
+		rl.SetMusicPitch(music, float32(*config.Rate)/100)
+	}
+
+	p.reset()
+	p.Resize()
+
+	over := false
+	for !rl.WindowShouldClose() && !rl.IsKeyPressed(rl.KeyEscape) {
+		if rl.IsWindowResized() {
+			p.Resize()
+		}
+		switch {
+		case rl.IsKeyPressed(*config.RestartKey):
+			p.Restart()
+		case rl.IsKeyPressed(*config.PauseKey) && p.paused:
+			p.Resume()
+		case rl.IsKeyPressed(*config.PauseKey):
+			p.Pause()
+		}
+
+		p.Update()
+		p.Render(p.Time())
+
+		if p.ended() {
+			over = true
+			break
+		}
+		if p.session.FailTime != 0 {
+			log.Println("failed at", p.session.FailTime)
+			over = true
+			break
 		}
-		return nil
-	}); nil != err {
-		return fmt.Errorf("unable to walk song directory: %w", err)
 	}
 
-	if (g.audioFile == "") || g.chartFile == "" {
-		return errors.New("unable to find .sm and .mp3/.ogg file in given directory")
+	// Watching a replay or the bot, or leaving a run, is not another score
+	if over && nil == p.replay {
+		p.Scorer.Save(&p.chart, &score.History{
+			Inputs: &p.session.Inputs,
+			Rate:   *config.Rate,
+			Failed: p.session.FailTime,
+			Pauses: p.pauses,
+		})
 	}
+}
 
-	var err error
-	g.charts, err = g.Parser.Parse(g.chartFile)
-	if nil != err {
-		return err
+// ended is whether the music has played to its end, or when there is no
+// music, whether every note has scrolled past
+func (p *Program) ended() bool {
+	if nil == p.music {
+		return p.session.Done()
 	}
+	return rl.GetMusicTimePlayed(*p.music) >= p.musicLength
+}
 
-	err = g.Scorer.Init()
-	if nil != err {
-		return err
+// progress is how much of the music has played, or of the chart when there
+// is no music, from 0 to 1
+func (p *Program) progress() float32 {
+	if nil != p.music {
+		return rl.GetMusicTimePlayed(*p.music) / p.musicLength
 	}
-	defer func() {
-		g.Scorer.Deinit()
-	}()
+	if len(p.chart.Notes) == 0 || p.chart.Notes[len(p.chart.Notes)-1].Time <= 0 {
+		return 1
+	}
+	return float32(p.session.Time()) / float32(p.chart.Notes[len(p.chart.Notes)-1].Time)
+}
 
-	g.chart = *g.charts[0]
-	g.counts = make([]int, len(config.Judgements))
-	g.inputs = []game.Input{}
+// musicPosition is the time in the chart that the music is at, once it is
+// playing
+func (p *Program) musicPosition() (time.Duration, bool) {
+	if nil == p.music || !rl.IsMusicStreamPlaying(*p.music) {
+		return 0, false
+	}
+	// The music is played at the rate, but its time is the song's
+	played := float64(rl.GetMusicTimePlayed(*p.music)) * float64(time.Second)
+	return *config.Offset + time.Duration(played*100/float64(*config.Rate)), true
+}
 
-	g.Resize()
+// choose picks the chart of song to play, which can be played again
+func (g *Program) choose(song *library.Song, chart *game.Chart) {
+	chart.Reset()
+	g.song = song
+	g.chart = *chart
+	g.audioFile = song.Audio(chart)
+}
 
-	return nil
+// selectChart is the first chart that matches difficulty, either a name or
+// an index into charts, and meter, where empty matches any chart
+func selectChart(charts []*game.Chart, difficulty, meter string) (*game.Chart, error) {
+	name := difficulty
+	if index, err := strconv.Atoi(difficulty); nil == err {
+		if index < 0 || index >= len(charts) {
+			return nil, fmt.Errorf("no chart at index %v, there are %v", index, len(charts))
+		}
+		charts = charts[index : index+1]
+		name = ""
+	}
+	for _, chart := range charts {
+		if name != "" && !strings.EqualFold(chart.Difficulty.Name, name) {
+			continue
+		}
+		if meter != "" && chart.Difficulty.Msd != meter {
+			continue
+		}
+		return chart, nil
+	}
+	return nil, fmt.Errorf("no chart with difficulty %q and meter %q", difficulty, meter)
 }
 
-func (p *Program) Update(duration time.Duration) {
+// ListCharts writes a tab separated line for every chart: its index, name,
+// meter, key count, note counts, hold count and mine count
+func (g *Program) ListCharts(w io.Writer) {
+	listCharts(w, "", g.charts)
+}
+
+// listCharts writes the lines of ListCharts, each starting with prefix
+func listCharts(w io.Writer, prefix string, charts []*game.Chart) {
+	for i, chart := range charts {
+		fmt.Fprintf(w, "%v%v\t%v\t%v\t%vk\t%v\t%v\t%v\n",
+			prefix,
+			i,
+			chart.Difficulty.Name,
+			chart.Difficulty.Msd,
+			chart.Difficulty.NKeys,
+			strings.Join(chart.NoteCountsAsStrings, ","),
+			chart.HoldCount,
+			chart.MineCount,
+		)
+	}
+}
+
+// Update advances the session to the time of the clock, and shows what
+// happened in it
+func (p *Program) Update() {
+	if p.paused {
+		// Keys pressed while paused are not played
+		p.session.Input.Poll(p.pausedAt)
+		if p.resumeAt.IsZero() || time.Now().Before(p.resumeAt) {
+			return
+		}
+		p.play()
+	}
+
+	// The music starts after the delay, and is offset from the chart
+	if nil != p.music {
+		if !p.musicStarted && p.wall.Now() >= *config.Offset {
+			rl.PlayMusicStream(*p.music)
+			p.musicStarted = true
+		}
+		rl.UpdateMusicStream(*p.music)
+	}
+
+	for _, event := range p.session.Update() {
+		switch event.Kind {
+		case play.EventHit, play.EventEmpty:
+			p.hitColumn(event)
+		case play.EventMiss:
+			p.missNote()
+		case play.EventMine:
+			p.hitMine(event.Note)
+		}
+	}
+}
+
+// keyboardInput is the InputSource of the player's keys, which are read
+// with the time they happened from evdev when it can, and otherwise each
+// frame, at the time of the frame
+func (g *Program) keyboardInput() play.InputSource {
+	queue := play.NewQueue(func(key int32) (uint8, error) {
+		return config.KeyColumn(key, g.chart.Difficulty.Type, g.chart.Difficulty.NKeys)
+	})
+	if err := evdev.Listen(*config.Evdev, queue.Events); nil != err {
+		log.Println("reading keys each frame:", err)
+		return &keyboard{chart: &g.chart}
+	}
+	return queue
+}
+
+// keyboard is the InputSource of the player's keys, read each frame
+type keyboard struct {
+	chart *game.Chart
+}
+
+func (k *keyboard) Poll(now time.Duration) []game.Input {
+	inputs := []game.Input{}
+
 	// get the key inputs that occured so far
 	for key := rl.GetKeyPressed(); key != 0; key = rl.GetKeyPressed() {
-		index, err := config.KeyColumn(key, p.chart.Difficulty.NKeys)
+		index, err := config.KeyColumn(key, k.chart.Difficulty.Type, k.chart.Difficulty.NKeys)
 		if nil != err {
 			log.Println("not a column index pressed")
 			continue
 		}
-		input := game.Input{Index: index, HitTime: duration}
-
-		p.inputs = append(p.inputs, input)
-
-		// Get the column to render the hit splash at
-		col := getColumn(p.chart.Difficulty.NKeys, p.middle.X, input.Index)
-
-		note, distance, abs := p.Scorer.ApplyInputToChart(&p.chart, &input, *config.Rate)
-		if note == nil {
-			// If this is hitting nothing
-			p.decorations = append(p.decorations, &Decoration{
-				frames: 24,
-				key:    key,
-				startCounting: func(note *game.Note, key int32) bool {
-					return rl.IsKeyReleased(key)
-				},
-				render: func(remaining int) {
-					g := rl.Gray
-					g.A = uint8(float32(255) * (float32(remaining) / 24))
-					rl.DrawCircleGradient(col, p.hitRow, *config.NoteRadius, g, rl.Black)
-				},
-			})
-			continue
+		inputs = append(inputs, game.Input{Index: index, HitTime: now})
+	}
+
+	// Releases hit lifts and let go of holds
+	for i, key := range config.Keys(k.chart.Difficulty.Type, k.chart.Difficulty.NKeys) {
+		if rl.IsKeyReleased(key) {
+			inputs = append(inputs, game.Input{Index: uint8(i), HitTime: now, Release: true})
 		}
+	}
+	return inputs
+}
+
+func (p *Program) hitMine(mine *game.Note) {
+	col := getColumn(p.chart.Difficulty.NKeys, p.middle.X, mine.Index)
+	p.decorations = append(p.decorations, &Decoration{
+		frames: 60,
+		render: func(remaining int) {
+			r := rl.Red
+			r.A = uint8(float32(255) * (float32(remaining) / 60))
+			rl.DrawCircleLines(col, p.hitRow, *config.NoteRadius+8, r)
+			rl.DrawCircleGradient(col, p.hitRow, *config.NoteRadius+4, r, rl.Black)
+		},
+	})
+}
+
+func (p *Program) missNote() {
+	worst := config.Judgements[len(config.Judgements)-2]
+	os := int32(2*-worst.Time.Milliseconds()) + p.middle.X
+	p.decorations = append(p.decorations, &Decoration{
+		frames: 120,
+		render: func(remaining int) {
+			g := config.Judgements[len(config.Judgements)-1].Color
+			g.A = uint8(float32(255) * (float32(remaining) / 120))
+			rl.DrawRectangle(
+				os-3,
+				int32(float32(p.middle.Y)*1.2)-5,
+				6,
+				30,
+				g,
+			)
+		},
+	})
+}
+
+func (p *Program) hitColumn(event play.Event) {
+	key := config.Keys(p.chart.Difficulty.Type, p.chart.Difficulty.NKeys)[event.Index]
 
-		p.distanceError += abs
-		p.totalHits += 1
-		p.sumOfDistance += distance
-		// because distance is < missDistance, this should never be nil
-		idx, judgement := judge(abs)
-		note.Judgement = judgement
+	// Get the column to render the hit splash at
+	col := getColumn(p.chart.Difficulty.NKeys, p.middle.X, event.Index)
 
+	if event.Kind == play.EventEmpty {
+		// If this is hitting nothing
 		p.decorations = append(p.decorations, &Decoration{
 			frames: 24,
 			key:    key,
-			note:   note,
 			startCounting: func(note *game.Note, key int32) bool {
-				released := rl.IsKeyReleased(key)
-				if released {
-					note.ReleaseTime = duration
-					return true
-				}
-				return false
+				return !p.session.Down(event.Index)
 			},
 			render: func(remaining int) {
-				g := judgement.Color
-				gr := g
-				gr.A = uint8(float32(255) * (float32(remaining) / 24))
-				rl.DrawCircle(col, p.hitRow, *config.NoteRadius+4, g)
-				rl.DrawCircle(col, p.hitRow, *config.NoteRadius, rl.Black)
+				g := rl.Gray
+				g.A = uint8(float32(255) * (float32(remaining) / 24))
 				rl.DrawCircleGradient(col, p.hitRow, *config.NoteRadius, g, rl.Black)
 			},
 		})
-
-		os := int32(2*-distance.Milliseconds()) + p.middle.X
-		p.decorations = append(p.decorations, &Decoration{
-			frames: 120,
-			render: func(remaining int) {
-				g := judgement.Color
-				g.A = uint8(float32(255) * (float32(remaining) / 120))
-				rl.DrawRectangle(
-					os-2,
-					int32(float32(p.middle.Y)*1.2),
-					4,
-					20,
-					g,
-				)
-			},
-		})
-
-		p.counts[idx]++
-		if p.totalHits > 1 {
-			p.stdev = 0.0
-			p.mean = float64(p.sumOfDistance) / float64(p.totalHits)
-			for _, n := range p.chart.Notes {
-				if n.HitTime == 0 {
-					continue
-				}
-				diff := p.Scorer.Distance(*config.Rate, n.Time, n.HitTime)
-				xi := float64(diff) - p.mean
-				xi2 := xi * xi
-				p.stdev += xi2
-			}
-			p.stdev /= float64(p.totalHits - 1)
-			p.stdev = math.Sqrt(p.stdev)
-		}
+		return
 	}
+
+	judgement := config.Judgements[event.Judgement]
+	p.decorations = append(p.decorations, &Decoration{
+		frames: 24,
+		key:    key,
+		note:   event.Note,
+		startCounting: func(note *game.Note, key int32) bool {
+			return !p.session.Down(event.Index)
+		},
+		render: func(remaining int) {
+			g := judgement.Color
+			gr := g
+			gr.A = uint8(float32(255) * (float32(remaining) / 24))
+			rl.DrawCircle(col, p.hitRow, *config.NoteRadius+4, g)
+			rl.DrawCircle(col, p.hitRow, *config.NoteRadius, rl.Black)
+			rl.DrawCircleGradient(col, p.hitRow, *config.NoteRadius, g, rl.Black)
+		},
+	})
+
+	os := int32(2*-event.Distance.Milliseconds()) + p.middle.X
+	p.decorations = append(p.decorations, &Decoration{
+		frames: 120,
+		render: func(remaining int) {
+			g := judgement.Color
+			g.A = uint8(float32(255) * (float32(remaining) / 120))
+			rl.DrawRectangle(
+				os-2,
+				int32(float32(p.middle.Y)*1.2),
+				4,
+				20,
+				g,
+			)
+		},
+	})
 }
 
 func (p *Program) Render(duration time.Duration) {
@@ -227,7 +467,11 @@ func (p *Program) Render(duration time.Duration) {
 
 	p.RenderBackgroundDecoration(duration)
 	p.RenderStatic()
+	p.RenderLife()
 	p.RenderGame(duration)
+	if p.paused {
+		p.RenderPause()
+	}
 
 	rl.EndDrawing()
 }
@@ -243,13 +487,13 @@ func (p *Program) RenderBackgroundDecoration(duration time.Duration) {
 			continue
 		}
 
-		y := p.hitRow - int32(pixelsFromHitbar(d))
+		y := p.hitRow - int32(pixelsFromHitbar(p.scrollDistance(m.Time, duration)))
 
 		rl.DrawLine(0, y, p.width, y, theme.MeasureColors[m.Denom])
 	}
 
 	for _, measure := range p.chart.Measures[end:] {
-		d := p.Scorer.Distance(*config.Rate, measure.Time, duration)
+		d := p.scrollDistance(measure.Time, duration)
 
 		// Check if this note will be rendered
 		if pixelsFromHitbar(d) < int64(p.hitRow) {
@@ -275,83 +519,61 @@ func (p *Program) RenderBackgroundDecoration(duration time.Duration) {
 	}
 }
 
+// scrollDistance is how far from the hit bar chart time t is drawn, in the
+// time it takes to scroll there, including any scroll and speed changes
+func (p *Program) scrollDistance(t, duration time.Duration) time.Duration {
+	timing := p.chart.Timing
+	if nil == timing || (len(timing.Scrolls) == 0 && len(timing.Speeds) == 0) {
+		return p.Scorer.Distance(*config.Rate, t, duration)
+	}
+	now := time.Duration(float64(duration) * float64(*config.Rate) / 100)
+	scrolled := timing.ScrollPosition(t) - timing.ScrollPosition(now)
+	return time.Duration(float64(scrolled) * 100 / float64(*config.Rate) * timing.SpeedAt(now))
+}
+
 func pixelsFromHitbar(timeFromHitbar time.Duration) int64 {
 	return int64(float64(timeFromHitbar) * config.PixelsPerNs)
 }
 
 func (p *Program) RenderGame(duration time.Duration) {
-	// Adjust the active note range
-	// The first time this is called, the active slice is empty
-	// and start, end = 0, 0
+	// The session has slid the start of the active window past the notes
+	// that are over, and the end is slid here to the notes that are shown
 	active, start, end := p.chart.Active()
 
 	// Render notes
 	for _, note := range active {
 		col := getColumn(p.chart.Difficulty.NKeys, p.middle.X, note.Index)
 
-		// This is the main use of the Distance function
-		d := p.Scorer.Distance(*config.Rate, note.Time, duration)
-
-		worst := config.Judgements[len(config.Judgements)-2]
-
-		// Check if this note will be rendered
-		if d < -worst.Time {
-			// This is scrolled past the bottom of the screen
-			// Check to see if the note was missed
-
-			if note.HitTime == 0 && note.MissTime == 0 && !note.IsMine {
-				eidx := len(p.counts) - 1
-				note.MissTime = duration
-				p.counts[eidx] += 1
-				os := int32(2*-worst.Time.Milliseconds()) + p.middle.X
-				p.decorations = append(p.decorations, &Decoration{
-					frames: 120,
-					render: func(remaining int) {
-						g := config.Judgements[len(config.Judgements)-1].Color
-						g.A = uint8(float32(255) * (float32(remaining) / 120))
-						rl.DrawRectangle(
-							os-3,
-							int32(float32(p.middle.Y)*1.2)-5,
-							6,
-							30,
-							g,
-						)
-					},
-				})
-			}
-
-			// Mark the active window to slide forward 1
-			// First check if we should keep rendering for the sake
-			// of holds spanning the entire screen
-			if active[0].TimeEnd != 0 {
-				de := p.Scorer.Distance(*config.Rate, note.TimeEnd, duration)
-				if de < -worst.Time {
-					start++
-				} // else holding window because end of hold note still active
-			} else {
-				start++
-			}
+		// Keysounds are only heard
+		if note.Kind == game.KindKeysound {
+			continue
 		}
 
 		if (note.HitTime == 0 && note.TimeEnd == 0) || (note.TimeEnd != 0) {
 			// This is still an active, relevant note
-			ps := pixelsFromHitbar(d)
+			ps := pixelsFromHitbar(p.scrollDistance(note.Time, duration))
 			x, y := col, p.hitRow-int32(ps)
 
-			if note.IsMine {
+			if note.IsMine() {
 				rl.DrawCircleLines(x, y, *config.NoteRadius, rl.DarkGray)
 			} else {
 				r, g, b := p.Theme.GetNoteColor(note.Denom)
 				color := rl.NewColor(r, g, b, 255)
+				if note.Kind == game.KindFake {
+					color.A = 96
+				}
 
 				if note.TimeEnd != 0 {
 					// This is a hold note
-					de := p.Scorer.Distance(*config.Rate, note.TimeEnd, duration)
-					pe := pixelsFromHitbar(de)
+					pe := pixelsFromHitbar(p.scrollDistance(note.TimeEnd, duration))
 					ye := p.hitRow - int32(pe)
-					if note.MissTime != 0 {
+					if note.MissTime != 0 || note.DropTime != 0 {
+						gone := note.MissTime
+						if note.DropTime != 0 {
+							gone = note.DropTime
+						}
 						// 250ms until gone
-						timeSince := duration.Milliseconds() - note.MissTime.Milliseconds()
+						timeSince := duration.Milliseconds() - gone.Milliseconds()
 						alpha := timeSince * 3
 						if alpha > 255 {
 							color.A = 0
@@ -403,7 +625,15 @@ func (p *Program) RenderGame(duration time.Duration) {
 						},
 						1, 1, 2, color,
 					)
-
+					if note.Kind == game.KindRoll {
+						// Stripe the body so that rolls stand out from holds
+						for sy := y - int32(*config.NoteRadius); sy > ye; sy -= int32(*config.NoteRadius) {
+							rl.DrawLine(x-int32(*config.NoteRadius), sy, x+int32(*config.NoteRadius), sy, color)
+						}
+					}
+				} else if note.Kind == game.KindLift {
+					rl.DrawCircleLines(x, y, *config.NoteRadius, color)
+					rl.DrawCircleLines(x, y, *config.NoteRadius-3, color)
 				} else {
 					rl.DrawCircle(x, y, *config.NoteRadius, color)
 				}
@@ -414,7 +644,7 @@ func (p *Program) RenderGame(duration time.Duration) {
 	// At the end of this render loop I want to see which notes will require rendering
 	// next frame and slide the window
 	for _, note := range p.chart.Notes[end:] {
-		d := p.Scorer.Distance(*config.Rate, note.Time, duration)
+		d := p.scrollDistance(note.Time, duration)
 
 		// Check if this note will be rendered
 		if pixelsFromHitbar(d) < int64(p.hitRow) {
@@ -428,6 +658,22 @@ func (p *Program) RenderGame(duration time.Duration) {
 	p.chart.SetActive(start, end)
 }
 
+// RenderLife draws the life bar to the right of the playfield, filling up
+// from the hit bar
+func (p *Program) RenderLife() {
+	x := getColumn(p.chart.Difficulty.NKeys, p.middle.X, p.chart.Difficulty.NKeys-1) + *config.ColumnSpacing/2
+	top := int32(40)
+	height := p.hitRow - top
+	fill := int32(float64(height) * p.session.Life / 100)
+
+	color := rl.Green
+	if p.session.Life < 25 {
+		color = rl.Red
+	}
+	rl.DrawRectangleLines(x, top, 12, height, rl.DarkGray)
+	rl.DrawRectangle(x+2, p.hitRow-fill, 8, fill, color)
+}
+
 func (p *Program) RenderStatic() {
 	// Render the hit bar
 	for i := uint8(0); i < p.chart.Difficulty.NKeys; i++ {
@@ -441,7 +687,7 @@ func (p *Program) RenderStatic() {
 		)
 	}
 
-	rl.DrawRectangle(0, 2, int32(float32(p.width)*(rl.GetMusicTimePlayed(*p.music)/p.musicLength)), 2, rl.White)
+	rl.DrawRectangle(0, 2, int32(float32(p.width)*p.progress()), 2, rl.White)
 
 	text := func(row float32, color rl.Color, template string, args ...interface{}) {
 		rl.DrawTextEx(p.Font,
@@ -455,14 +701,23 @@ func (p *Program) RenderStatic() {
 	rl.DrawFPS(p.sideCol, 3*24)
 	notes, start, end := p.chart.Active()
 	measures, ms, me := p.chart.ActiveMeasures()
+	if nil != p.chart.Song {
+		text(7, rl.White, "%v", p.chart.Song.FullTitle())
+		text(8, rl.Gray, "%v", p.chart.Song.Artist)
+	}
+	text(9, rl.Gray, "%v %v (%v)", p.chart.Difficulty.Name, p.chart.Difficulty.Msd, p.chart.Difficulty.Type)
 	text(4, rl.White, " Active Window [%v - %v] (%v)", start, end, len(notes))
 	text(5, rl.White, " Measure Window [%v - %v] (%v)", ms, me, len(measures))
-	text(10, rl.White, "   Error dt: %6.0f ms", float64(p.distanceError)/float64(time.Millisecond))
-	text(11, rl.White, "      Stdev: %6.2f ms", p.stdev/float64(time.Millisecond))
-	text(12, rl.White, "       Mean: %6.2f ms", p.mean/float64(time.Millisecond))
+	text(6, rl.Gray, "      Drift: %+6.2f ms", float64(p.clock.Drift)/float64(time.Millisecond))
+	s := p.session
+	text(10, rl.White, "   Error dt: %6.0f ms", float64(s.DistanceError)/float64(time.Millisecond))
+	text(11, rl.White, "      Stdev: %6.2f ms", s.Stdev/float64(time.Millisecond))
+	text(12, rl.White, "       Mean: %6.2f ms", s.Mean/float64(time.Millisecond))
 	text(13, rl.White, "      Notes: %4v", strings.Join(p.chart.NoteCountsAsStrings, ", "))
-	text(14, rl.White, "      Holds: %4v", p.chart.HoldCount)
-	text(15, rl.White, "      Mines: %4v", p.chart.MineCount)
+	text(14, rl.White, "      Holds: %4v  OK: %4v  NG: %4v", p.chart.HoldCount, s.OKCount, s.NGCount)
+	text(15, rl.White, "      Mines: %4v  Hit: %4v", p.chart.MineCount, s.MineHits)
+	text(16, rl.White, "       Wife: %6.2f%%", score.WifePercent(s.WifePoints, s.JudgedNotes))
+	text(17, rl.Gray, "      Judge: %v  Fail: %v", config.Judge.Name, config.Fail)
 	sh := int32(float32(p.middle.Y) * 1.2)
 	for i, j := range config.Judgements {
 		if i < len(config.Judgements)-1 {
@@ -473,6 +728,6 @@ func (p *Program) RenderStatic() {
 			rl.DrawLine(os, sh+5, os, sh+10, col)
 			rl.DrawLine(osp, sh+5, osp, sh+10, col)
 		}
-		text(18+float32(i), j.Color, "%s: %4v", j.Name, p.counts[i])
+		text(18+float32(i), j.Color, "%s: %4v", j.Name, s.Counts[i])
 	}
 }
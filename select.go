@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unsafe"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/game"
+	"git.lost.host/meutraa/eotw/internal/library"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// How long a song is chosen before its preview plays, and how long the
+// preview is when the song does not say
+const (
+	previewDelay  = 300 * time.Millisecond
+	previewLength = 12 * time.Second
+)
+
+// SongSelect is the list of the charts of every song, grouped by pack, that
+// the chart to play is chosen from
+type SongSelect struct {
+	entries []entry
+	cursor  int // The entry of the chosen chart, or -1 when there are none
+	moved   time.Time
+
+	// Search finds the packs of the songs that match what is typed, and the
+	// list can not be searched when it is nil
+	Search func(query string) ([]*library.Pack, error)
+	query  string
+
+	// The preview of the chosen song's music, which is loaded once it has
+	// been chosen for a moment
+	preview     rl.Sound
+	previewSong *library.Song
+	previewing  bool
+}
+
+// entry is a line of the list, which is a pack, a song, or one of its charts
+type entry struct {
+	pack  *library.Pack
+	song  *library.Song
+	chart *game.Chart
+}
+
+func NewSongSelect(packs []*library.Pack) *SongSelect {
+	s := &SongSelect{}
+	s.list(packs)
+	return s
+}
+
+// list replaces the entries with the charts of packs, and chooses the first
+func (s *SongSelect) list(packs []*library.Pack) {
+	s.entries, s.cursor, s.moved = nil, -1, time.Now()
+	for _, pack := range packs {
+		s.entries = append(s.entries, entry{pack: pack})
+		for _, song := range pack.Songs {
+			s.entries = append(s.entries, entry{pack: pack, song: song})
+			for _, chart := range song.Charts {
+				if s.cursor < 0 {
+					s.cursor = len(s.entries)
+				}
+				s.entries = append(s.entries, entry{pack: pack, song: song, chart: chart})
+			}
+		}
+	}
+}
+
+// search lists the songs that match query
+func (s *SongSelect) search(query string) {
+	packs, err := s.Search(query)
+	if nil != err {
+		log.Println(err)
+		return
+	}
+	s.query = query
+	s.list(packs)
+}
+
+// typed is the search with the letters, numbers and spaces that were typed
+// added, or the last character removed by backspace
+func (s *SongSelect) typed() string {
+	query := s.query
+	for key := rl.GetKeyPressed(); key > 0; key = rl.GetKeyPressed() {
+		switch {
+		case key == rl.KeyBackspace && len(query) > 0:
+			query = query[:len(query)-1]
+		case key == rl.KeySpace, key >= rl.KeyZero && key <= rl.KeyNine:
+			query += string(rune(key))
+		case key >= rl.KeyA && key <= rl.KeyZ:
+			query += strings.ToLower(string(rune(key)))
+		}
+	}
+	return query
+}
+
+// Choose shows the list until a chart is chosen, and returns it, or nil when
+// the list is left
+func (s *SongSelect) Choose(font rl.Font) (*library.Song, *game.Chart) {
+	anyChart := func(from, to entry) bool { return true }
+	otherSong := func(from, to entry) bool { return from.song != to.song }
+	otherPack := func(from, to entry) bool { return from.pack != to.pack }
+
+	// Keys are only read again once a frame is drawn, so the Escape that
+	// left a chart would leave the list too
+	s.render(font)
+	for !rl.WindowShouldClose() {
+		if nil != s.Search {
+			if query := s.typed(); query != s.query {
+				s.search(query)
+			}
+		}
+		switch {
+		case rl.IsKeyPressed(rl.KeyEscape) && s.query != "":
+			s.search("")
+		case rl.IsKeyPressed(rl.KeyEscape):
+			s.Close()
+			return nil, nil
+		case s.cursor < 0:
+		case rl.IsKeyPressed(rl.KeyEnter):
+			s.Close()
+			chosen := s.entries[s.cursor]
+			return chosen.song, chosen.chart
+		case rl.IsKeyPressed(rl.KeyDown):
+			s.move(1, anyChart)
+		case rl.IsKeyPressed(rl.KeyUp):
+			s.move(-1, anyChart)
+		case rl.IsKeyPressed(rl.KeyRight):
+			s.move(1, otherSong)
+		case rl.IsKeyPressed(rl.KeyLeft):
+			s.move(-1, otherSong)
+		case rl.IsKeyPressed(rl.KeyPageDown):
+			s.move(1, otherPack)
+		case rl.IsKeyPressed(rl.KeyPageUp):
+			s.move(-1, otherPack)
+		}
+		s.updatePreview()
+		s.render(font)
+	}
+	s.Close()
+	return nil, nil
+}
+
+// move moves the cursor to the next chart in direction dir that is next
+// from the chosen one
+func (s *SongSelect) move(dir int, next func(from, to entry) bool) {
+	from := s.entries[s.cursor]
+	for i := s.cursor + dir; i >= 0 && i < len(s.entries); i += dir {
+		if nil != s.entries[i].chart && next(from, s.entries[i]) {
+			s.cursor = i
+			s.moved = time.Now()
+			return
+		}
+	}
+}
+
+// updatePreview plays the preview of the chosen song, on repeat
+func (s *SongSelect) updatePreview() {
+	if s.cursor < 0 {
+		s.Close()
+		return
+	}
+	song := s.entries[s.cursor].song
+	// Searching lists the same songs again
+	if (nil == s.previewSong || song.Directory != s.previewSong.Directory) && time.Since(s.moved) > previewDelay {
+		s.Close()
+		s.previewSong = song
+		info := song.Info()
+		length := info.SampleLength
+		if length == 0 {
+			length = previewLength
+		}
+		// Keysounded songs have no music to preview
+		if file := song.Audio(song.Charts[0]); file != "" {
+			s.preview, s.previewing = loadPreview(file, info.SampleStart, length)
+		}
+	}
+	if s.previewing && !rl.IsSoundPlaying(s.preview) {
+		rl.PlaySound(s.preview)
+	}
+}
+
+// Close stops and unloads the preview
+func (s *SongSelect) Close() {
+	if s.previewing {
+		rl.StopSound(s.preview)
+		rl.UnloadSound(s.preview)
+	}
+	s.previewing = false
+	s.previewSong = nil
+}
+
+func (s *SongSelect) render(font rl.Font) {
+	width, height := int32(rl.GetScreenWidth()), int32(rl.GetScreenHeight())
+	size := float32(*config.FontSize)
+	row := int32(size * 1.25)
+	rows := int(height/row) - 3
+
+	first := s.cursor - rows/2
+	if first < 0 {
+		first = 0
+	}
+
+	rl.BeginDrawing()
+	rl.ClearBackground(rl.Black)
+
+	for i := first; i < len(s.entries) && i < first+rows; i++ {
+		e := s.entries[i]
+		y := int32(i-first+1) * row
+		if i == s.cursor {
+			rl.DrawRectangle(0, y-2, width, row, rl.DarkGray)
+		}
+
+		var text string
+		var indent float32
+		color := rl.Gray
+		switch {
+		case nil == e.song:
+			text, color = e.pack.Name, rl.Gold
+		case nil == e.chart:
+			text, indent, color = e.song.Title(), 1, rl.White
+			if artist := e.song.Info().Artist; artist != "" {
+				text += " - " + artist
+			}
+		default:
+			text, indent = fmt.Sprintf("%-12v %3v  %vk  %v  holds %v  mines %v",
+				e.chart.Difficulty.Name,
+				e.chart.Difficulty.Msd,
+				e.chart.Difficulty.NKeys,
+				strings.Join(e.chart.NoteCountsAsStrings, ","),
+				e.chart.HoldCount,
+				e.chart.MineCount,
+			), 2
+			if i == s.cursor {
+				color = rl.White
+			}
+		}
+		rl.DrawTextEx(font, text, rl.Vector2{X: size * (1 + 2*indent), Y: float32(y)}, size, 1, color)
+	}
+
+	help := "Enter play  Up/Down chart  Left/Right song  PgUp/PgDn pack  Esc quit"
+	if nil != s.Search {
+		help = "Type to search  " + help
+	}
+	if s.query != "" {
+		help = "Search: " + s.query + "  Esc clear"
+	}
+	rl.DrawTextEx(font, help, rl.Vector2{X: size, Y: float32(height - 2*row)}, size, 1, rl.Gray)
+
+	rl.EndDrawing()
+}
+
+// wave is the layout of rl.Wave, whose samples raylib-go does not export
+type wave struct {
+	SampleCount uint32 // Of every channel
+	SampleRate  uint32
+	SampleSize  uint32 // In bits
+	Channels    uint32
+	Data        unsafe.Pointer
+}
+
+// loadPreview loads the part of the music in file from start that lasts
+// length. Music streams can not be seeked in this raylib, so the whole
+// file is decoded and then cut.
+func loadPreview(file string, start, length time.Duration) (rl.Sound, bool) {
+	full := rl.LoadWave(file)
+	defer rl.UnloadWave(full)
+	w := (*wave)(unsafe.Pointer(&full))
+	if nil == w.Data || 0 == w.Channels || 0 == w.SampleRate {
+		log.Println("unable to load preview", file)
+		return rl.Sound{}, false
+	}
+
+	frames := int64(w.SampleCount / w.Channels)
+	from := int64(start.Seconds() * float64(w.SampleRate))
+	to := from + int64(length.Seconds()*float64(w.SampleRate))
+	if from >= frames {
+		from, to = 0, to-from
+	}
+	if to > frames {
+		to = frames
+	}
+	if to <= from {
+		log.Println("no preview in", file)
+		return rl.Sound{}, false
+	}
+
+	frameSize := int64(w.SampleSize / 8 * w.Channels)
+	samples := (*[1 << 30]byte)(w.Data)[from*frameSize : to*frameSize : to*frameSize]
+	cut := make([]byte, len(samples))
+	copy(cut, samples)
+
+	part := rl.NewWave(uint32(to-from)*w.Channels, w.SampleRate, w.SampleSize, w.Channels, cut)
+	return rl.LoadSoundFromWave(part), true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"git.lost.host/meutraa/eotw/internal/config"
+	"git.lost.host/meutraa/eotw/internal/play"
+	"git.lost.host/meutraa/eotw/internal/score"
+)
+
+// simulate plays the selected chart with the inputs file, or the replay or
+// bot, without a window, and writes the score to w
+func simulate(program *Program, w io.Writer) error {
+	if *config.SimulateInputs != "" {
+		file, err := os.Open(*config.SimulateInputs)
+		if nil != err {
+			return err
+		}
+		defer file.Close()
+		inputs, err := play.ReadInputs(file)
+		if nil != err {
+			return fmt.Errorf("unable to read inputs: %w", err)
+		}
+		program.replay = inputs
+	}
+	if nil == program.replay {
+		return errors.New("simulate needs an inputs file, --replay or --autoplay")
+	}
+
+	clock := &play.VirtualClock{}
+	s := play.NewSession(&program.chart, program.Scorer, clock, play.NewReplay(program.replay), *config.Rate)
+	play.Simulate(s, clock, time.Millisecond)
+
+	if nil != program.chart.Song {
+		fmt.Fprintf(w, "%v - %v\n", program.chart.Song.FullTitle(), program.chart.Song.Artist)
+	}
+	fmt.Fprintf(w, "%v %v (%v) at %v%%\n", program.chart.Difficulty.Name, program.chart.Difficulty.Msd, program.chart.Difficulty.Type, *config.Rate)
+	fmt.Fprintf(w, "Wife: %.2f%% (%v)\n", score.WifePercent(s.WifePoints, s.JudgedNotes), config.Judge.Name)
+	for i, j := range config.Judgements {
+		fmt.Fprintf(w, "%v: %v\n", j.Name, s.Counts[i])
+	}
+	fmt.Fprintf(w, "Holds: %v OK: %v NG: %v\n", program.chart.HoldCount, s.OKCount, s.NGCount)
+	fmt.Fprintf(w, "Mines: %v Hit: %v\n", program.chart.MineCount, s.MineHits)
+	fmt.Fprintf(w, "Mean: %.2f ms Stdev: %.2f ms\n", s.Mean/float64(time.Millisecond), s.Stdev/float64(time.Millisecond))
+	fmt.Fprintf(w, "Life: %.2f%% (%v)\n", s.Life, config.Fail)
+	if s.FailTime != 0 {
+		fmt.Fprintf(w, "Failed at %v\n", s.FailTime)
+	}
+	return nil
+}